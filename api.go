@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"file-transfer-app/transfer"
+)
+
+// --------------------------- 本机控制接口 ---------------------------
+// 控制接口只监听 127.0.0.1，供同一台机器上的脚本和工具调用，所有请求都需携带访问令牌：
+// 请求头 "Authorization: Bearer <令牌>"、请求头 X-Token 或查询参数 t。
+// GET /api/events 以 Server-Sent Events 推送与前端相同的 stats-updated、status-updated
+// 和 operation-completed 事件，data 为对应事件参数的 JSON。
+const (
+	ControlAPIPort     = 60005
+	apiEventBuffer     = 64               // 每个事件流订阅者的缓冲事件数，满时丢弃
+	apiKeepAlive       = 15 * time.Second // 事件流的保活注释间隔
+	apiPeersTimeout    = 3 * time.Second
+	apiShutdownTimeout = 5 * time.Second
+	apiHeaderTimeout   = 10 * time.Second // 读取请求头的超时
+	apiMaxBody         = 8 << 20          // 请求体的最大字节数，容纳 JSON 转义后的最长文本消息
+)
+
+// ControlAPIInfo 为控制接口的访问信息
+type ControlAPIInfo struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// apiEvent 为推送给事件流订阅者的一条事件
+type apiEvent struct {
+	name string
+	data []byte
+}
+
+type controlAPI struct {
+	app   *App
+	token string
+	srv   *http.Server
+	url   string
+	done  chan struct{} // 停止时关闭，结束所有事件流
+
+	mu          sync.Mutex
+	subscribers map[chan apiEvent]struct{}
+}
+
+// publish 将事件推送给所有订阅者，订阅者处理不及时时丢弃该事件
+func (c *controlAPI) publish(name string, data ...interface{}) {
+	var payload interface{}
+	if len(data) > 0 {
+		payload = data[0]
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subscribers {
+		select {
+		case ch <- apiEvent{name: name, data: b}:
+		default:
+		}
+	}
+}
+
+func (c *controlAPI) subscribe() chan apiEvent {
+	ch := make(chan apiEvent, apiEventBuffer)
+	c.mu.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.mu.Unlock()
+	return ch
+}
+
+func (c *controlAPI) unsubscribe(ch chan apiEvent) {
+	c.mu.Lock()
+	delete(c.subscribers, ch)
+	c.mu.Unlock()
+}
+
+// --------------------------- 请求处理 ---------------------------
+func (c *controlAPI) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.Header.Get("X-Token")
+		}
+		if token == "" {
+			token = r.URL.Query().Get("t")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+			apiError(w, http.StatusUnauthorized, fmt.Errorf("访问令牌无效"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, err error) {
+	apiJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// apiDecode 读取不超过 apiMaxBody 的 JSON 请求体，失败时已写入 400 或 413 响应
+func apiDecode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBody)).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apiError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("请求体超过 %s", transfer.FormatFileSize(apiMaxBody)))
+		return false
+	}
+	apiError(w, http.StatusBadRequest, fmt.Errorf("请求格式错误: %v", err))
+	return false
+}
+
+// apiMethod 只允许指定的请求方法
+func apiMethod(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			apiError(w, http.StatusMethodNotAllowed, fmt.Errorf("不支持的请求方法: %s", r.Method))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (c *controlAPI) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/peers", apiMethod(http.MethodGet, c.handlePeers))
+	mux.HandleFunc("/api/send", apiMethod(http.MethodPost, c.handleSend))
+	mux.HandleFunc("/api/text", apiMethod(http.MethodPost, c.handleText))
+	mux.HandleFunc("/api/receive", c.handleReceive)
+	mux.HandleFunc("/api/queue", c.handleQueue)
+	mux.HandleFunc("/api/sessions", apiMethod(http.MethodGet, c.handleSessions))
+	mux.HandleFunc("/api/stats", apiMethod(http.MethodGet, c.handleStats))
+	mux.HandleFunc("/api/history", apiMethod(http.MethodGet, c.handleHistory))
+	mux.HandleFunc("/api/cancel", apiMethod(http.MethodPost, c.handleCancel))
+	mux.HandleFunc("/api/events", apiMethod(http.MethodGet, c.handleEvents))
+	return c.authorize(mux)
+}
+
+// handlePeers 列出网络中的接收端，可用 timeout 参数（如 5s）调整等待时间
+func (c *controlAPI) handlePeers(w http.ResponseWriter, r *http.Request) {
+	timeout := apiPeersTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > transfer.TimeoutDuration {
+			apiError(w, http.StatusBadRequest, fmt.Errorf("无效的等待时间: %s", v))
+			return
+		}
+		timeout = d
+	}
+	peers, err := (&transfer.Discoverer{}).FindAll(timeout)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if peers == nil {
+		peers = []string{}
+	}
+	apiJSON(w, http.StatusOK, map[string]interface{}{"peers": peers})
+}
+
+// handleSend 开始发送，请求体为 {"paths": [...], "to": "接收端地址", "options": SendOptions}，to 为空时自动发现。
+// 指定 "targets": [...] 时同时发送到其中的每个接收端，此时忽略 to。
+func (c *controlAPI) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paths   []string             `json:"paths"`
+		To      string               `json:"to"`
+		Targets []string             `json:"targets"`
+		Options transfer.SendOptions `json:"options"`
+	}
+	if !apiDecode(w, r, &req) {
+		return
+	}
+	if len(req.Paths) == 0 {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("未选择要发送的文件"))
+		return
+	}
+	send := func() error { return c.app.sendTo(req.Paths, req.Options, req.To) }
+	if len(req.Targets) > 0 {
+		send = func() error { return c.app.SendToMany(req.Paths, req.Targets, req.Options) }
+	}
+	if err := send(); err != nil {
+		apiError(w, http.StatusConflict, err)
+		return
+	}
+	apiJSON(w, http.StatusAccepted, c.app.sessionInfo())
+}
+
+// handleText 发送文本消息，请求体为 {"text": "内容", "to": "接收端地址"}，to 为空时自动发现
+func (c *controlAPI) handleText(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+		To   string `json:"to"`
+	}
+	if !apiDecode(w, r, &req) {
+		return
+	}
+	if req.Text == "" {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("文本为空"))
+		return
+	}
+	if err := c.app.sendTextTo(req.Text, req.To); err != nil {
+		apiError(w, http.StatusConflict, err)
+		return
+	}
+	apiJSON(w, http.StatusAccepted, c.app.sessionInfo())
+}
+
+// handleReceive POST 开始接收，DELETE 停止接收
+func (c *controlAPI) handleReceive(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = c.app.Receive()
+	case http.MethodDelete:
+		err = c.app.CancelReceive()
+	default:
+		apiError(w, http.StatusMethodNotAllowed, fmt.Errorf("不支持的请求方法: %s", r.Method))
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusConflict, err)
+		return
+	}
+	apiJSON(w, http.StatusAccepted, c.app.sessionInfo())
+}
+
+// handleQueue GET 返回发送队列，POST 加入任务（请求体为 Job，使用 paths、target、options、priority、window
+// 和 retries），DELETE 移除查询参数 id 指定的任务
+func (c *controlAPI) handleQueue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		apiJSON(w, http.StatusOK, map[string]interface{}{"jobs": c.app.GetQueue()})
+	case http.MethodPost:
+		var job transfer.Job
+		if !apiDecode(w, r, &job) {
+			return
+		}
+		job, err := c.app.EnqueueSend(job)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+		apiJSON(w, http.StatusCreated, job)
+	case http.MethodDelete:
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			apiError(w, http.StatusBadRequest, fmt.Errorf("无效的任务编号: %s", r.URL.Query().Get("id")))
+			return
+		}
+		if err := c.app.RemoveJob(id); err != nil {
+			apiError(w, http.StatusNotFound, err)
+			return
+		}
+		apiJSON(w, http.StatusOK, map[string]interface{}{"jobs": c.app.GetQueue()})
+	default:
+		apiError(w, http.StatusMethodNotAllowed, fmt.Errorf("不支持的请求方法: %s", r.Method))
+	}
+}
+
+// handleSessions 返回会话列表。应用同一时间只有一个会话，列表中为当前或最近一次会话。
+func (c *controlAPI) handleSessions(w http.ResponseWriter, r *http.Request) {
+	apiJSON(w, http.StatusOK, map[string]interface{}{"sessions": []sessionInfo{c.app.sessionInfo()}})
+}
+
+func (c *controlAPI) handleStats(w http.ResponseWriter, r *http.Request) {
+	apiJSON(w, http.StatusOK, c.app.GetStats())
+}
+
+func (c *controlAPI) handleHistory(w http.ResponseWriter, r *http.Request) {
+	apiJSON(w, http.StatusOK, map[string]interface{}{"history": c.app.GetHistory()})
+}
+
+func (c *controlAPI) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if err := c.app.Cancel(); err != nil {
+		apiError(w, http.StatusConflict, err)
+		return
+	}
+	apiJSON(w, http.StatusAccepted, c.app.sessionInfo())
+}
+
+// handleEvents 以 Server-Sent Events 推送事件，直到客户端断开
+func (c *controlAPI) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, http.StatusInternalServerError, fmt.Errorf("不支持事件流"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := c.subscribe()
+	defer c.unsubscribe(ch)
+	keepAlive := time.NewTicker(apiKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.done:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, ev.data)
+		}
+		flusher.Flush()
+	}
+}
+
+// --------------------------- 会话信息 ---------------------------
+// sessionInfo 为控制接口返回的会话状态
+type sessionInfo struct {
+	Running bool           `json:"running"`
+	Stats   transfer.Stats `json:"stats"`
+}
+
+func (a *App) sessionInfo() sessionInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return sessionInfo{Running: a.Running, Stats: a.Stats}
+}
+
+// --------------------------- 前端绑定方法 ---------------------------
+// StartControlAPI 在 127.0.0.1 上启动本机控制接口，返回地址和访问令牌。已启动时返回现有的访问信息。
+func (a *App) StartControlAPI() (ControlAPIInfo, error) {
+	if api := a.controlAPI.Load(); api != nil {
+		return ControlAPIInfo{URL: api.url, Token: api.token}, nil
+	}
+
+	token, err := transfer.NewWebToken()
+	if err != nil {
+		return ControlAPIInfo{}, err
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ControlAPIPort))
+	if err != nil {
+		return ControlAPIInfo{}, fmt.Errorf("监听端口失败: %v", err)
+	}
+
+	api := &controlAPI{
+		app:         a,
+		token:       token,
+		url:         "http://" + ln.Addr().String(),
+		done:        make(chan struct{}),
+		subscribers: make(map[chan apiEvent]struct{}),
+	}
+	api.srv = &http.Server{Handler: api.routes(), ReadHeaderTimeout: apiHeaderTimeout}
+	if !a.controlAPI.CompareAndSwap(nil, api) {
+		ln.Close()
+		api = a.controlAPI.Load()
+		return ControlAPIInfo{URL: api.url, Token: api.token}, nil
+	}
+	go api.srv.Serve(ln)
+	return ControlAPIInfo{URL: api.url, Token: api.token}, nil
+}
+
+// StopControlAPI 停止本机控制接口，断开所有事件流
+func (a *App) StopControlAPI() error {
+	api := a.controlAPI.Swap(nil)
+	if api == nil {
+		return nil
+	}
+	close(api.done)
+	ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer cancel()
+	if err := api.srv.Shutdown(ctx); err != nil {
+		return api.srv.Close()
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIDecodeLimitsBody(t *testing.T) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	decode := func(body string) (*httptest.ResponseRecorder, bool) {
+		rec := httptest.NewRecorder()
+		ok := apiDecode(rec, httptest.NewRequest(http.MethodPost, "/api/text", strings.NewReader(body)), &req)
+		return rec, ok
+	}
+
+	if rec, ok := decode(`{"text": "hi"}`); !ok || req.Text != "hi" {
+		t.Errorf("正常的请求体: %d %s", rec.Code, rec.Body)
+	}
+	if rec, ok := decode(`{"text": "` + strings.Repeat("a", apiMaxBody) + `"}`); ok || rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超大的请求体: %d，应为 413", rec.Code)
+	}
+	if rec, ok := decode(`{"text": `); ok || rec.Code != http.StatusBadRequest {
+		t.Errorf("格式错误的请求体: %d，应为 400", rec.Code)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -13,6 +14,11 @@ var assets embed.FS
 
 // main 函数是应用程序的入口点
 func main() {
+	// 带子命令运行时进入命令行模式，不启动图形界面
+	if isCLICommand(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	// 创建一个App结构体的实例
 	app := NewApp()
 
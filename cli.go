@@ -0,0 +1,586 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"file-transfer-app/transfer"
+)
+
+// --------------------------- 命令行退出码 ---------------------------
+const (
+	ExitOK     = 0 // 成功
+	ExitFailed = 1 // 传输失败
+	ExitUsage  = 2 // 参数错误
+	ExitNoPeer = 3 // 未发现接收端
+)
+
+const (
+	peersWaitTime  = 3 * time.Second        // 查找接收端的默认等待时间
+	progressPeriod = 200 * time.Millisecond // 进度行刷新间隔
+)
+
+const cliUsage = `用法:
+  lanfile send <路径>... [--to 主机] [--include 模式] [--exclude 模式] [--preset 名称]
+                         [--gitignore] [--symlinks follow|skip|link] [--limit MB/s]
+                         [--delta] [--dedup] [--archive tar|tar.gz|zip]
+  lanfile send <路径>... --to 主机 --to 主机... [--buffer MB] [过滤参数] [--limit MB/s]
+  lanfile send --text 文本 [--to 主机]
+  lanfile send --stdin [--name 文件名] [--to 主机] [--limit MB/s]
+  lanfile receive [--dir 目录] [--limit MB/s] [--no-metadata] [--margin MB]
+                  [--on-file 命令] [--on-session 命令] [--hook-timeout 5m] [--extract] [--allow-sync]
+  lanfile receive --stdout [--limit MB/s] [--on-session 命令]
+  lanfile peers [--timeout 3s]
+  lanfile share <共享名>=<目录>... [--allow 地址] [--limit MB/s]
+  lanfile browse --from 主机 [共享名 [目录]]
+  lanfile pull --from 主机 <共享名> [路径]... [--dir 目录] [--limit MB/s] [--no-metadata]
+
+不带子命令运行时启动图形界面。
+`
+
+// isCLICommand 判断命令行参数是否为命令行模式的子命令
+func isCLICommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "send", "receive", "peers", "share", "browse", "pull", "help", "-h", "--help":
+		return true
+	}
+	return false
+}
+
+// runCLI 执行命令行子命令并返回退出码，与图形界面使用相同的传输协议
+func runCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "send":
+		return cliSend(args[1:], stdin, stdout, stderr)
+	case "receive":
+		return cliReceive(args[1:], stdout, stderr)
+	case "peers":
+		return cliPeers(args[1:], stdout, stderr)
+	case "share":
+		return cliShare(args[1:], stdout, stderr)
+	case "browse":
+		return cliBrowse(args[1:], stdout, stderr)
+	case "pull":
+		return cliPull(args[1:], stdout, stderr)
+	default:
+		fmt.Fprint(stdout, cliUsage)
+		return ExitOK
+	}
+}
+
+// --------------------------- 参数解析 ---------------------------
+// stringList 为可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, cliUsage) }
+	return fs
+}
+
+// parseInterspersed 允许参数与路径交错出现，如 "send a.txt --to host b.txt"
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// --------------------------- 终端进度 ---------------------------
+// cliReporter 实现 transfer.Observer，将状态与统计信息输出到终端，进度行按固定间隔刷新
+type cliReporter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	lastDraw time.Time
+	inLine   bool
+}
+
+func (r *cliReporter) StatusChanged(status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endLine()
+	fmt.Fprintln(r.out, status)
+}
+
+func (r *cliReporter) StatsUpdated(stats transfer.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stats.TotalBytes == 0 && stats.TotalFiles == 0 {
+		return
+	}
+	final := stats.Status == "completed" || stats.Status == "failed"
+	if !final && time.Since(r.lastDraw) < progressPeriod {
+		return
+	}
+	r.lastDraw = time.Now()
+	r.draw(stats)
+	if final {
+		r.endLine()
+	}
+}
+
+func (r *cliReporter) draw(s transfer.Stats) {
+	line := fmt.Sprintf("%5.1f%%  %d/%d 个文件  %s/%s  %.2f MB/s",
+		s.Progress, s.CompletedFiles, s.TotalFiles,
+		transfer.FormatFileSize(s.TransferredBytes), transfer.FormatFileSize(s.TotalBytes), s.CurrentSpeed)
+	// 数据流的总大小未知，只显示已传输的字节数
+	unknownTotal := s.TotalBytes == 0 && s.Status == "transferring"
+	if unknownTotal {
+		line = fmt.Sprintf("已传输 %s  %.2f MB/s", transfer.FormatFileSize(s.TransferredBytes), s.CurrentSpeed)
+	}
+	if s.EstimatedTime != "" && s.Status == "transferring" && !unknownTotal {
+		line += "  剩余 " + s.EstimatedTime
+	}
+	if s.Throttled {
+		line += "  (限速中)"
+	}
+	if s.SavedBytes > 0 {
+		line += "  节省 " + transfer.FormatFileSize(s.SavedBytes)
+	}
+	fmt.Fprintf(r.out, "\r%-72s", line)
+	r.inLine = true
+}
+
+func (r *cliReporter) endLine() {
+	if r.inLine {
+		fmt.Fprintln(r.out)
+		r.inLine = false
+	}
+}
+
+// TargetStatusChanged 输出一对多发送中单个接收端的状态，各接收端的进度只在结束时汇总
+func (r *cliReporter) TargetStatusChanged(target, status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endLine()
+	fmt.Fprintf(r.out, "[%s] %s\n", target, status)
+}
+
+func (r *cliReporter) TargetStatsUpdated(string, transfer.Stats) {}
+
+// TextReceived 将收到的文本原样输出，便于在管道中使用
+func (r *cliReporter) TextReceived(msg transfer.TextMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endLine()
+	fmt.Fprintf(r.out, "收到来自 %s 的文本:\n%s\n", msg.Peer, msg.Text)
+}
+
+// finish 结束未换行的进度行
+func (r *cliReporter) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endLine()
+}
+
+// --------------------------- 子命令 ---------------------------
+func cliSend(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("send", stderr)
+	var to stringList
+	fs.Var(&to, "to", "接收端地址（主机或 主机:端口），可重复指定以同时发送到多个接收端，不指定时自动发现")
+	var opts transfer.SendOptions
+	var include, exclude, presets stringList
+	fs.Var(&include, "include", "包含模式，可重复指定")
+	fs.Var(&exclude, "exclude", "排除模式，可重复指定")
+	fs.Var(&presets, "preset", "排除预设: vcs, node, build, os-junk，可重复指定")
+	fs.BoolVar(&opts.UseIgnoreFiles, "gitignore", false, "遵循目录树中的 .gitignore")
+	fs.StringVar(&opts.SymlinkPolicy, "symlinks", transfer.SymlinkFollow, "符号链接策略: follow, skip, link")
+	fs.BoolVar(&opts.Delta, "delta", false, "对接收端已有的同名文件只发送差异")
+	fs.BoolVar(&opts.Dedup, "dedup", false, "内容重复的文件只发送一次")
+	fs.StringVar(&opts.Archive, "archive", "", "打包为归档流发送: tar, tar.gz, zip")
+	limit := fs.Float64("limit", 0, "限速 (MB/s)，0 表示不限速")
+	text := fs.String("text", "", "发送一条文本消息而不是文件")
+	useStdin := fs.Bool("stdin", false, "将标准输入作为一个文件发送，直到输入结束")
+	name := fs.String("name", "stdin", "--stdin 时接收端保存的文件名")
+	buffer := fs.Int64("buffer", 0, "同时发送到多个接收端时，每个接收端可落后的数据量 (MB)，0 使用默认值")
+
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if *text != "" && len(paths) > 0 {
+		fmt.Fprintln(stderr, "--text 不能与文件同时发送")
+		return ExitUsage
+	}
+	if *useStdin && (len(paths) > 0 || *text != "") {
+		fmt.Fprintln(stderr, "--stdin 不能与文件或 --text 同时发送")
+		return ExitUsage
+	}
+	if *text == "" && !*useStdin && len(paths) == 0 {
+		fmt.Fprintln(stderr, "未指定要发送的文件")
+		fs.Usage()
+		return ExitUsage
+	}
+	opts.Include, opts.Exclude, opts.Presets = include, exclude, presets
+
+	filter, err := transfer.NewFilter(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	if *limit < 0 {
+		fmt.Fprintln(stderr, "限速值不能为负数")
+		return ExitUsage
+	}
+	switch opts.Archive {
+	case "", transfer.ArchiveTar, transfer.ArchiveTarGz, transfer.ArchiveZip:
+	default:
+		fmt.Fprintf(stderr, "未知的归档格式: %s\n", opts.Archive)
+		return ExitUsage
+	}
+	if len(to) > 1 {
+		if *text != "" || *useStdin || opts.Delta || opts.Dedup || opts.Archive != "" {
+			fmt.Fprintln(stderr, "发送到多个接收端时不能使用 --text、--stdin、--delta、--dedup 和 --archive")
+			return ExitUsage
+		}
+		if *buffer < 0 {
+			fmt.Fprintln(stderr, "缓冲大小不能为负数")
+			return ExitUsage
+		}
+		return cliSendToMany(paths, to, filter, *limit, *buffer, stdout, stderr)
+	}
+
+	target := ""
+	if len(to) == 1 {
+		target = to[0]
+	}
+	if target == "" {
+		fmt.Fprintln(stdout, "正在查找接收端...")
+		peers, err := (&transfer.Discoverer{}).FindAll(peersWaitTime)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitNoPeer
+		}
+		if len(peers) == 0 {
+			fmt.Fprintln(stderr, "未发现接收端，请确认对方已运行 lanfile receive 或使用 --to 指定地址")
+			return ExitNoPeer
+		}
+		if len(peers) > 1 {
+			fmt.Fprintf(stderr, "发现多个接收端，请使用 --to 指定: %s\n", strings.Join(peers, ", "))
+			return ExitUsage
+		}
+		target = peers[0]
+	}
+
+	reporter := &cliReporter{out: stdout}
+	sender := &transfer.Sender{
+		Filter:   filter,
+		Observer: reporter,
+		Limiters: []*transfer.RateLimiter{transfer.NewRateLimiter(*limit)},
+		Delta:    opts.Delta,
+		Dedup:    opts.Dedup,
+		Archive:  opts.Archive,
+	}
+	switch {
+	case *text != "":
+		err = sender.SendText(*text, target)
+	case *useStdin:
+		err = sender.SendStream(stdin, *name, target)
+	default:
+		err = sender.Send(paths, target)
+	}
+	reporter.finish()
+	if err != nil {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+// cliSendToMany 同时发送到多个接收端，进度行显示读取进度，结束后逐个列出各接收端的结果
+func cliSendToMany(paths, targets []string, filter *transfer.Filter, limit float64, bufferMB int64, stdout, stderr io.Writer) int {
+	reporter := &cliReporter{out: stdout}
+	sender := &transfer.Sender{
+		Filter:         filter,
+		Observer:       reporter,
+		Limiters:       []*transfer.RateLimiter{transfer.NewRateLimiter(limit)},
+		TargetObserver: reporter,
+		FanOutBuffer:   bufferMB * 1024 * 1024,
+	}
+	results, err := sender.SendToMany(paths, targets)
+	reporter.finish()
+
+	code := ExitOK
+	if err != nil {
+		code = ExitFailed
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			fmt.Fprintf(stderr, "%s: 失败: %s\n", res.Target, res.Error)
+			code = ExitFailed
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: 完成，%d 个文件 %s\n", res.Target, res.Stats.CompletedFiles, transfer.FormatFileSize(res.Stats.TransferredBytes))
+	}
+	return code
+}
+
+func cliReceive(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("receive", stderr)
+	dir := fs.String("dir", ".", "保存目录")
+	limit := fs.Float64("limit", 0, "限速 (MB/s)，0 表示不限速")
+	noMeta := fs.Bool("no-metadata", false, "不恢复修改时间和权限")
+	margin := fs.Int64("margin", 0, "接收后应保留的最小剩余空间 (MB)，0 表示不检查")
+	onFile := fs.String("on-file", "", "每个文件接收完成后执行的命令")
+	onSession := fs.String("on-session", "", "会话结束后执行的命令")
+	hookTimeout := fs.Duration("hook-timeout", transfer.DefaultHookTimeout, "钩子命令的超时")
+	extract := fs.Bool("extract", false, "收到归档流时边接收边解压，而不是保存归档文件")
+	allowSync := fs.Bool("allow-sync", false, "允许对方同步保存目录下的同名文件夹（会修改和删除其中的文件）")
+	toStdout := fs.Bool("stdout", false, "将收到的单个文件写到标准输出而不保存，进度输出到标准错误")
+
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(stderr, "多余的参数: %s\n", strings.Join(rest, " "))
+		fs.Usage()
+		return ExitUsage
+	}
+
+	if *limit < 0 || *margin < 0 || *hookTimeout < 0 {
+		fmt.Fprintln(stderr, "限速值、剩余空间和超时不能为负数")
+		return ExitUsage
+	}
+	if *toStdout && *onFile != "" {
+		fmt.Fprintln(stderr, "--stdout 时不保存文件，不能使用 --on-file")
+		return ExitUsage
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Fprintf(stderr, "创建保存目录失败: %v\n", err)
+		return ExitFailed
+	}
+
+	// 写到标准输出时，进度和状态改为输出到标准错误，以免混入数据
+	reporter := &cliReporter{out: stdout}
+	if *toStdout {
+		reporter.out = stderr
+	}
+	receiver := &transfer.Receiver{
+		Dir:              *dir,
+		PreserveMetadata: !*noMeta,
+		ExtractArchives:  *extract,
+		AllowSync:        *allowSync,
+		FreeSpaceMargin:  *margin * 1024 * 1024,
+		Observer:         reporter,
+		Limiters:         []*transfer.RateLimiter{transfer.NewRateLimiter(*limit)},
+		Hooks:            transfer.Hooks{OnFile: *onFile, OnSession: *onSession, Timeout: *hookTimeout},
+		TextObserver:     reporter,
+	}
+	if *toStdout {
+		receiver.Output = stdout
+		fmt.Fprintln(stderr, "正在等待发送端连接，文件将写到标准输出")
+	} else {
+		fmt.Fprintf(stdout, "正在等待发送端连接，文件将保存到 %s\n", *dir)
+	}
+	err = receiver.Receive()
+	reporter.finish()
+	record := receiver.Record()
+	for _, res := range record.Hooks {
+		if !res.Failed() {
+			continue
+		}
+		reason := res.Error
+		if reason == "" {
+			reason = fmt.Sprintf("退出码 %d", res.ExitCode)
+		}
+		fmt.Fprintf(stderr, "钩子执行失败 (%s %s): %s\n", res.Event, res.File, reason)
+		if out := strings.TrimRight(res.Output, "\n"); out != "" {
+			fmt.Fprintln(stderr, out)
+		}
+	}
+	if record.HooksOmitted > 0 {
+		fmt.Fprintf(stderr, "另有 %d 个钩子的结果未保留，共 %d 个钩子执行失败\n", record.HooksOmitted, record.HooksFailed)
+	}
+	if err != nil {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+func cliPeers(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("peers", stderr)
+	timeout := fs.Duration("timeout", peersWaitTime, "等待应答的时间")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	peers, err := (&transfer.Discoverer{}).FindAll(*timeout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitFailed
+	}
+	if len(peers) == 0 {
+		fmt.Fprintln(stderr, "未发现接收端")
+		return ExitNoPeer
+	}
+	for _, p := range peers {
+		fmt.Fprintln(stdout, p)
+	}
+	return ExitOK
+}
+
+func cliShare(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("share", stderr)
+	var allow stringList
+	fs.Var(&allow, "allow", "允许访问的设备地址，可重复指定，不指定时允许所有设备")
+	limit := fs.Float64("limit", 0, "限速 (MB/s)，0 表示不限速")
+
+	specs, err := parseInterspersed(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(specs) == 0 {
+		fmt.Fprintln(stderr, "未指定要共享的文件夹")
+		fs.Usage()
+		return ExitUsage
+	}
+	if *limit < 0 {
+		fmt.Fprintln(stderr, "限速值不能为负数")
+		return ExitUsage
+	}
+
+	shares := make([]transfer.Share, 0, len(specs))
+	for _, spec := range specs {
+		name, dir, ok := strings.Cut(spec, "=")
+		if !ok {
+			fmt.Fprintf(stderr, "共享格式应为 名称=目录: %s\n", spec)
+			return ExitUsage
+		}
+		shares = append(shares, transfer.Share{Name: name, Path: dir, Allow: allow})
+	}
+
+	server := &transfer.ShareServer{
+		Observer: &cliReporter{out: stdout},
+		Limiters: []*transfer.RateLimiter{transfer.NewRateLimiter(*limit)},
+	}
+	if err := server.SetShares(shares); err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+	if err := server.Start(fmt.Sprintf(":%d", transfer.SharePort)); err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitFailed
+	}
+	for _, sh := range server.Shares() {
+		fmt.Fprintf(stdout, "正在共享 %s: %s\n", sh.Name, sh.Path)
+	}
+	fmt.Fprintln(stdout, "按 Ctrl+C 停止共享")
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	server.Stop()
+	return ExitOK
+}
+
+func cliBrowse(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("browse", stderr)
+	from := fs.String("from", "", "共享端地址")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if *from == "" || len(rest) > 2 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	if len(rest) == 0 {
+		names, err := transfer.ListShares(*from)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitFailed
+		}
+		for _, name := range names {
+			fmt.Fprintln(stdout, name)
+		}
+		return ExitOK
+	}
+
+	dir := ""
+	if len(rest) == 2 {
+		dir = rest[1]
+	}
+	entries, err := transfer.BrowseShare(*from, rest[0], dir)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitFailed
+	}
+	for _, e := range entries {
+		if e.IsDir {
+			fmt.Fprintf(stdout, "%-10s  %s  %s/\n", "<目录>", e.ModTime.Format("2006-01-02 15:04"), e.Name)
+		} else {
+			fmt.Fprintf(stdout, "%10s  %s  %s\n", transfer.FormatFileSize(e.Size), e.ModTime.Format("2006-01-02 15:04"), e.Name)
+		}
+	}
+	return ExitOK
+}
+
+func cliPull(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("pull", stderr)
+	from := fs.String("from", "", "共享端地址")
+	dir := fs.String("dir", ".", "保存目录")
+	limit := fs.Float64("limit", 0, "限速 (MB/s)，0 表示不限速")
+	noMeta := fs.Bool("no-metadata", false, "不恢复修改时间和权限")
+
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if *from == "" || len(rest) == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+	if *limit < 0 {
+		fmt.Fprintln(stderr, "限速值不能为负数")
+		return ExitUsage
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Fprintf(stderr, "创建保存目录失败: %v\n", err)
+		return ExitFailed
+	}
+
+	reporter := &cliReporter{out: stdout}
+	receiver := &transfer.Receiver{
+		Dir:              *dir,
+		PreserveMetadata: !*noMeta,
+		Observer:         reporter,
+		Limiters:         []*transfer.RateLimiter{transfer.NewRateLimiter(*limit)},
+	}
+	err = receiver.Pull(*from, rest[0], rest[1:])
+	reporter.finish()
+	if err != nil {
+		return ExitFailed
+	}
+	return ExitOK
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"file-transfer-app/transfer"
+)
+
+func TestIsCLICommand(t *testing.T) {
+	for _, args := range [][]string{{"send", "a.txt"}, {"receive"}, {"peers"}, {"share"}, {"browse"}, {"pull"}, {"help"}, {"--help"}} {
+		if !isCLICommand(args) {
+			t.Errorf("%v 应为命令行模式", args)
+		}
+	}
+	for _, args := range [][]string{nil, {}, {"-debug"}, {"a.txt"}} {
+		if isCLICommand(args) {
+			t.Errorf("%v 应启动图形界面", args)
+		}
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var to stringList
+	fs.Var(&to, "to", "")
+	delta := fs.Bool("delta", false, "")
+
+	paths, err := parseInterspersed(fs, []string{"a.txt", "--to", "h1", "b.txt", "--delta", "--to=h2", "--", "--c.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "b.txt", "--c.txt"}; !slices.Equal(paths, want) {
+		t.Errorf("路径 = %v，应为 %v", paths, want)
+	}
+	if !slices.Equal(to, []string{"h1", "h2"}) || !*delta {
+		t.Errorf("--to = %v, --delta = %v", to, *delta)
+	}
+
+	if _, err := parseInterspersed(fs, []string{"a.txt", "--unknown"}); err == nil {
+		t.Error("未知参数应报错")
+	}
+}
+
+// 参数错误在连接任何接收端之前以 ExitUsage 退出
+func TestCLIUsageErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]string{
+		{"send"},
+		{"send", "--bogus", file},
+		{"send", "--text", "hi", file},
+		{"send", "--stdin", file},
+		{"send", "--limit", "-1", file},
+		{"send", "--archive", "rar", file},
+		{"send", "--symlinks", "maybe", file},
+		{"send", "--to", "h1", "--to", "h2", "--delta", file},
+		{"send", "--to", "h1", "--to", "h2", "--buffer", "-1", file},
+		{"receive", "extra"},
+		{"receive", "--margin", "-1"},
+		{"receive", "--stdout", "--on-file", "echo"},
+		{"peers", "--timeout", "soon"},
+	}
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := runCLI(args, strings.NewReader(""), &stdout, &stderr); code != ExitUsage {
+			t.Errorf("%v: 退出码 %d，应为 %d (%s)", args, code, ExitUsage, stderr.String())
+		}
+	}
+}
+
+func TestCLIHelp(t *testing.T) {
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"help"}, nil, &stdout, io.Discard); code != ExitOK {
+		t.Errorf("退出码 %d", code)
+	}
+	if !strings.Contains(stdout.String(), "lanfile send") {
+		t.Errorf("未输出用法: %q", stdout.String())
+	}
+}
+
+// fakeReceiver 接受一次连接，同意接收后返回收到的全部内容
+func fakeReceiver(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- ""
+			return
+		}
+		defer conn.Close()
+		var b strings.Builder
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			b.WriteString(line)
+			if err != nil || strings.HasPrefix(line, transfer.StatsMarker+"|") {
+				break
+			}
+		}
+		conn.Write([]byte(transfer.AcceptMarker + "\n"))
+		rest, _ := io.ReadAll(reader)
+		b.Write(rest)
+		got <- b.String()
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestCLISendExitCodes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(file, []byte("hello cli"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, got := fakeReceiver(t)
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"send", file, "--to", addr}, nil, &stdout, &stderr); code != ExitOK {
+		t.Fatalf("退出码 %d (%s)", code, stderr.String())
+	}
+	stream := <-got
+	if !strings.Contains(stream, "hello cli") || !strings.HasSuffix(stream, transfer.EndMarker+"\n") {
+		t.Errorf("接收端收到 %q", stream)
+	}
+
+	// 接收端不可达时为传输失败
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+	if code := runCLI([]string{"send", file, "--to", closed}, nil, io.Discard, io.Discard); code != ExitFailed {
+		t.Errorf("接收端不可达: 退出码 %d，应为 %d", code, ExitFailed)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"file-transfer-app/transfer"
+)
+
+// --------------------------- 一对多发送 ---------------------------
+// targetObserver 将各接收端的进度转发为 target-status 和 target-stats 事件，第一个参数为接收端地址
+type targetObserver struct {
+	app *App
+}
+
+func (o targetObserver) TargetStatusChanged(target, status string) {
+	o.app.emit("target-status", target, status)
+}
+
+func (o targetObserver) TargetStatsUpdated(target string, stats transfer.Stats) {
+	o.app.emit("target-stats", target, stats)
+}
+
+// SendToMany 在后台将 paths 同时发送到 targets 中的每个接收端，每个文件只读取一次。
+// stats-updated 为读取进度，各接收端的进度通过 target-status 和 target-stats 事件通知；
+// 结束时发送 fanout-completed 事件，参数为各接收端的结果。差异传输、去重和归档选项不生效。
+func (a *App) SendToMany(paths, targets []string, opts transfer.SendOptions) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("未指定接收端")
+	}
+	filter, err := transfer.NewFilter(opts)
+	if err != nil {
+		return err
+	}
+
+	return a.runExclusive("", func() {
+		a.mu.Lock()
+		buffer := a.fanOutBuffer
+		a.mu.Unlock()
+		sender := &transfer.Sender{
+			Filter:         filter,
+			Observer:       appObserver{a},
+			Limiters:       a.beginSession(),
+			TargetObserver: targetObserver{a},
+			FanOutBuffer:   buffer,
+		}
+		a.setActive(sender)
+		results, _ := sender.SendToMany(paths, targets)
+		a.emit("fanout-completed", results)
+	})
+}
+
+// SetFanOutBuffer 设置一对多发送时每个接收端可落后的数据量 (MB)，0 使用默认值
+func (a *App) SetFanOutBuffer(bufferMB int64) error {
+	if bufferMB < 0 {
+		return fmt.Errorf("缓冲大小不能为负数")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.fanOutBuffer = bufferMB * 1024 * 1024
+	return nil
+}
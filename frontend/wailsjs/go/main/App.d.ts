@@ -1,17 +1,110 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
+import {transfer} from '../models';
+
+export function BrowseRemoteShare(arg1:string,arg2:string,arg3:string):Promise<Array<transfer.ShareEntry>>;
+
+export function Cancel():Promise<void>;
+
+export function CancelJob(arg1:number):Promise<void>;
+
+export function ClearFinishedJobs():Promise<void>;
+
+export function EnqueueSend(arg1:transfer.Job):Promise<transfer.Job>;
 
 export function GetFileInfo(arg1:string):Promise<Record<string, any>>;
 
-export function GetStats():Promise<main.TransferStats>;
+export function GetFileInfoWithOptions(arg1:string,arg2:transfer.SendOptions):Promise<Record<string, any>>;
+
+export function GetFilterPresets():Promise<Record<string, Array<string>>>;
+
+export function GetHistory():Promise<Array<transfer.Record>>;
+
+export function GetQueue():Promise<Array<transfer.Job>>;
+
+export function GetShareLink():Promise<string>;
+
+export function GetShareQRCode():Promise<string>;
+
+export function GetShares():Promise<Array<transfer.Share>>;
+
+export function GetStats():Promise<transfer.Stats>;
+
+export function GetTextHistory():Promise<Array<transfer.TextMessage>>;
+
+export function GetWatchStatus():Promise<transfer.WatchStatus>;
+
+export function ListRemoteShares(arg1:string):Promise<Array<string>>;
+
+export function MoveJob(arg1:number,arg2:number):Promise<void>;
+
+export function PreviewSync(arg1:string,arg2:string):Promise<transfer.SyncPlan>;
+
+export function Pull(arg1:string,arg2:string,arg3:Array<string>):Promise<void>;
 
 export function Receive():Promise<void>;
 
+export function RemoveJob(arg1:number):Promise<void>;
+
 export function RestartReceive():Promise<void>;
 
+export function RetryJob(arg1:number):Promise<void>;
+
 export function SelectFile():Promise<string>;
 
+export function SelectFiles():Promise<Array<string>>;
+
 export function SelectFolder():Promise<string>;
 
 export function Send(arg1:string):Promise<void>;
+
+export function SendClipboard():Promise<void>;
+
+export function SendMany(arg1:Array<string>):Promise<void>;
+
+export function SendManyWithOptions(arg1:Array<string>,arg2:transfer.SendOptions):Promise<void>;
+
+export function SendText(arg1:string):Promise<void>;
+
+export function SendToMany(arg1:Array<string>,arg2:Array<string>,arg3:transfer.SendOptions):Promise<void>;
+
+export function SendWithOptions(arg1:string,arg2:transfer.SendOptions):Promise<void>;
+
+export function SetCopyReceivedText(arg1:boolean):Promise<void>;
+
+export function SetExtractArchives(arg1:boolean):Promise<void>;
+
+export function SetFanOutBuffer(arg1:number):Promise<void>;
+
+export function SetFreeSpaceMargin(arg1:number):Promise<void>;
+
+export function SetJobPriority(arg1:number,arg2:number):Promise<void>;
+
+export function SetPreserveMetadata(arg1:boolean):Promise<void>;
+
+export function SetQueueConcurrency(arg1:number):Promise<void>;
+
+export function SetRateLimit(arg1:number,arg2:number):Promise<void>;
+
+export function SetReceiveHooks(arg1:string,arg2:string,arg3:number):Promise<void>;
+
+export function StartControlAPI():Promise<main.ControlAPIInfo>;
+
+export function StartSharing(arg1:Array<transfer.Share>):Promise<void>;
+
+export function StartWatch(arg1:string,arg2:string,arg3:transfer.SendOptions):Promise<void>;
+
+export function StartWebReceive():Promise<string>;
+
+export function StartWebShare(arg1:Array<string>):Promise<string>;
+
+export function StopControlAPI():Promise<void>;
+
+export function StopSharing():Promise<void>;
+
+export function StopWatch():Promise<void>;
+
+export function StopWebServer():Promise<void>;
+
+export function Sync(arg1:string,arg2:string):Promise<void>;
@@ -2,26 +2,110 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function BrowseRemoteShare(arg1, arg2, arg3) {
+  return window['go']['main']['App']['BrowseRemoteShare'](arg1, arg2, arg3);
+}
+
+export function Cancel() {
+  return window['go']['main']['App']['Cancel']();
+}
+
+export function CancelJob(arg1) {
+  return window['go']['main']['App']['CancelJob'](arg1);
+}
+
+export function ClearFinishedJobs() {
+  return window['go']['main']['App']['ClearFinishedJobs']();
+}
+
+export function EnqueueSend(arg1) {
+  return window['go']['main']['App']['EnqueueSend'](arg1);
+}
+
 export function GetFileInfo(arg1) {
   return window['go']['main']['App']['GetFileInfo'](arg1);
 }
 
+export function GetFileInfoWithOptions(arg1, arg2) {
+  return window['go']['main']['App']['GetFileInfoWithOptions'](arg1, arg2);
+}
+
+export function GetFilterPresets() {
+  return window['go']['main']['App']['GetFilterPresets']();
+}
+
+export function GetHistory() {
+  return window['go']['main']['App']['GetHistory']();
+}
+
+export function GetQueue() {
+  return window['go']['main']['App']['GetQueue']();
+}
+
+export function GetShareLink() {
+  return window['go']['main']['App']['GetShareLink']();
+}
+
+export function GetShareQRCode() {
+  return window['go']['main']['App']['GetShareQRCode']();
+}
+
+export function GetShares() {
+  return window['go']['main']['App']['GetShares']();
+}
+
 export function GetStats() {
   return window['go']['main']['App']['GetStats']();
 }
 
+export function GetTextHistory() {
+  return window['go']['main']['App']['GetTextHistory']();
+}
+
+export function GetWatchStatus() {
+  return window['go']['main']['App']['GetWatchStatus']();
+}
+
+export function ListRemoteShares(arg1) {
+  return window['go']['main']['App']['ListRemoteShares'](arg1);
+}
+
+export function MoveJob(arg1, arg2) {
+  return window['go']['main']['App']['MoveJob'](arg1, arg2);
+}
+
+export function PreviewSync(arg1, arg2) {
+  return window['go']['main']['App']['PreviewSync'](arg1, arg2);
+}
+
+export function Pull(arg1, arg2, arg3) {
+  return window['go']['main']['App']['Pull'](arg1, arg2, arg3);
+}
+
 export function Receive() {
   return window['go']['main']['App']['Receive']();
 }
 
+export function RemoveJob(arg1) {
+  return window['go']['main']['App']['RemoveJob'](arg1);
+}
+
 export function RestartReceive() {
   return window['go']['main']['App']['RestartReceive']();
 }
 
+export function RetryJob(arg1) {
+  return window['go']['main']['App']['RetryJob'](arg1);
+}
+
 export function SelectFile() {
   return window['go']['main']['App']['SelectFile']();
 }
 
+export function SelectFiles() {
+  return window['go']['main']['App']['SelectFiles']();
+}
+
 export function SelectFolder() {
   return window['go']['main']['App']['SelectFolder']();
 }
@@ -29,3 +113,103 @@ export function SelectFolder() {
 export function Send(arg1) {
   return window['go']['main']['App']['Send'](arg1);
 }
+
+export function SendClipboard() {
+  return window['go']['main']['App']['SendClipboard']();
+}
+
+export function SendMany(arg1) {
+  return window['go']['main']['App']['SendMany'](arg1);
+}
+
+export function SendManyWithOptions(arg1, arg2) {
+  return window['go']['main']['App']['SendManyWithOptions'](arg1, arg2);
+}
+
+export function SendText(arg1) {
+  return window['go']['main']['App']['SendText'](arg1);
+}
+
+export function SendToMany(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SendToMany'](arg1, arg2, arg3);
+}
+
+export function SendWithOptions(arg1, arg2) {
+  return window['go']['main']['App']['SendWithOptions'](arg1, arg2);
+}
+
+export function SetCopyReceivedText(arg1) {
+  return window['go']['main']['App']['SetCopyReceivedText'](arg1);
+}
+
+export function SetExtractArchives(arg1) {
+  return window['go']['main']['App']['SetExtractArchives'](arg1);
+}
+
+export function SetFanOutBuffer(arg1) {
+  return window['go']['main']['App']['SetFanOutBuffer'](arg1);
+}
+
+export function SetFreeSpaceMargin(arg1) {
+  return window['go']['main']['App']['SetFreeSpaceMargin'](arg1);
+}
+
+export function SetJobPriority(arg1, arg2) {
+  return window['go']['main']['App']['SetJobPriority'](arg1, arg2);
+}
+
+export function SetPreserveMetadata(arg1) {
+  return window['go']['main']['App']['SetPreserveMetadata'](arg1);
+}
+
+export function SetQueueConcurrency(arg1) {
+  return window['go']['main']['App']['SetQueueConcurrency'](arg1);
+}
+
+export function SetRateLimit(arg1, arg2) {
+  return window['go']['main']['App']['SetRateLimit'](arg1, arg2);
+}
+
+export function SetReceiveHooks(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetReceiveHooks'](arg1, arg2, arg3);
+}
+
+export function StartControlAPI() {
+  return window['go']['main']['App']['StartControlAPI']();
+}
+
+export function StartSharing(arg1) {
+  return window['go']['main']['App']['StartSharing'](arg1);
+}
+
+export function StartWatch(arg1, arg2, arg3) {
+  return window['go']['main']['App']['StartWatch'](arg1, arg2, arg3);
+}
+
+export function StartWebReceive() {
+  return window['go']['main']['App']['StartWebReceive']();
+}
+
+export function StartWebShare(arg1) {
+  return window['go']['main']['App']['StartWebShare'](arg1);
+}
+
+export function StopControlAPI() {
+  return window['go']['main']['App']['StopControlAPI']();
+}
+
+export function StopSharing() {
+  return window['go']['main']['App']['StopSharing']();
+}
+
+export function StopWatch() {
+  return window['go']['main']['App']['StopWatch']();
+}
+
+export function StopWebServer() {
+  return window['go']['main']['App']['StopWebServer']();
+}
+
+export function Sync(arg1, arg2) {
+  return window['go']['main']['App']['Sync'](arg1, arg2);
+}
@@ -1,6 +1,251 @@
 export namespace main {
 	
-	export class TransferStats {
+	export class ControlAPIInfo {
+	    url: string;
+	    token: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ControlAPIInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.url = source["url"];
+	        this.token = source["token"];
+	    }
+	}
+
+}
+
+export namespace transfer {
+	
+	export class Duplicate {
+	    path: string;
+	    source: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Duplicate(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.source = source["source"];
+	    }
+	}
+	export class HookResult {
+	    event: string;
+	    command: string;
+	    file: string;
+	    exitCode: number;
+	    output: string;
+	    error: string;
+	    duration: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HookResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.event = source["event"];
+	        this.command = source["command"];
+	        this.file = source["file"];
+	        this.exitCode = source["exitCode"];
+	        this.output = source["output"];
+	        this.error = source["error"];
+	        this.duration = source["duration"];
+	    }
+	}
+	export class Job {
+	    id: number;
+	    paths: string[];
+	    target: string;
+	    options: SendOptions;
+	    priority: number;
+	    window: TimeWindow;
+	    retries: number;
+	    state: string;
+	    attempts: number;
+	    lastError: string;
+	    // Go type: time
+	    nextRun: any;
+	    // Go type: time
+	    added: any;
+	    // Go type: time
+	    finished: any;
+	    stats: Stats;
+	
+	    static createFrom(source: any = {}) {
+	        return new Job(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.paths = source["paths"];
+	        this.target = source["target"];
+	        this.options = this.convertValues(source["options"], SendOptions);
+	        this.priority = source["priority"];
+	        this.window = this.convertValues(source["window"], TimeWindow);
+	        this.retries = source["retries"];
+	        this.state = source["state"];
+	        this.attempts = source["attempts"];
+	        this.lastError = source["lastError"];
+	        this.nextRun = this.convertValues(source["nextRun"], null);
+	        this.added = this.convertValues(source["added"], null);
+	        this.finished = this.convertValues(source["finished"], null);
+	        this.stats = this.convertValues(source["stats"], Stats);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Record {
+	    peer: string;
+	    root: string;
+	    files: number;
+	    bytes: number;
+	    outcome: string;
+	    error: string;
+	    // Go type: time
+	    started: any;
+	    // Go type: time
+	    finished: any;
+	    hooks: HookResult[];
+	    dups: Duplicate[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Record(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer = source["peer"];
+	        this.root = source["root"];
+	        this.files = source["files"];
+	        this.bytes = source["bytes"];
+	        this.outcome = source["outcome"];
+	        this.error = source["error"];
+	        this.started = this.convertValues(source["started"], null);
+	        this.finished = this.convertValues(source["finished"], null);
+	        this.hooks = this.convertValues(source["hooks"], HookResult);
+	        this.dups = this.convertValues(source["dups"], Duplicate);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SendOptions {
+	    include: string[];
+	    exclude: string[];
+	    presets: string[];
+	    useIgnoreFiles: boolean;
+	    symlinkPolicy: string;
+	    delta: boolean;
+	    dedup: boolean;
+	    archive: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SendOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.include = source["include"];
+	        this.exclude = source["exclude"];
+	        this.presets = source["presets"];
+	        this.useIgnoreFiles = source["useIgnoreFiles"];
+	        this.symlinkPolicy = source["symlinkPolicy"];
+	        this.delta = source["delta"];
+	        this.dedup = source["dedup"];
+	        this.archive = source["archive"];
+	    }
+	}
+	export class Share {
+	    name: string;
+	    path: string;
+	    allow: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Share(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.path = source["path"];
+	        this.allow = source["allow"];
+	    }
+	}
+	export class ShareEntry {
+	    name: string;
+	    isDir: boolean;
+	    size: number;
+	    // Go type: time
+	    modTime: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new ShareEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.isDir = source["isDir"];
+	        this.size = source["size"];
+	        this.modTime = this.convertValues(source["modTime"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Stats {
 	    totalFiles: number;
 	    completedFiles: number;
 	    totalBytes: number;
@@ -10,9 +255,12 @@ export namespace main {
 	    currentFile: string;
 	    progress: number;
 	    status: string;
+	    rateLimit: number;
+	    throttled: boolean;
+	    savedBytes: number;
 	
 	    static createFrom(source: any = {}) {
-	        return new TransferStats(source);
+	        return new Stats(source);
 	    }
 	
 	    constructor(source: any = {}) {
@@ -26,8 +274,161 @@ export namespace main {
 	        this.currentFile = source["currentFile"];
 	        this.progress = source["progress"];
 	        this.status = source["status"];
+	        this.rateLimit = source["rateLimit"];
+	        this.throttled = source["throttled"];
+	        this.savedBytes = source["savedBytes"];
 	    }
 	}
+	export class SyncChange {
+	    path: string;
+	    action: string;
+	    size: number;
+	    conflictPath: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncChange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.action = source["action"];
+	        this.size = source["size"];
+	        this.conflictPath = source["conflictPath"];
+	    }
+	}
+	export class SyncPlan {
+	    changes: SyncChange[];
+	    uploadBytes: number;
+	    downloadBytes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncPlan(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.changes = this.convertValues(source["changes"], SyncChange);
+	        this.uploadBytes = source["uploadBytes"];
+	        this.downloadBytes = source["downloadBytes"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TextMessage {
+	    peer: string;
+	    text: string;
+	    // Go type: time
+	    received: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new TextMessage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer = source["peer"];
+	        this.text = source["text"];
+	        this.received = this.convertValues(source["received"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TimeWindow {
+	    start: string;
+	    end: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TimeWindow(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.start = source["start"];
+	        this.end = source["end"];
+	    }
+	}
+	export class WatchStatus {
+	    dir: string;
+	    target: string;
+	    watching: boolean;
+	    pending: number;
+	    sending: boolean;
+	    sentFiles: number;
+	    message: string;
+	    lastError: string;
+	    // Go type: time
+	    nextRetry: any;
+	    stats: Stats;
+	
+	    static createFrom(source: any = {}) {
+	        return new WatchStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dir = source["dir"];
+	        this.target = source["target"];
+	        this.watching = source["watching"];
+	        this.pending = source["pending"];
+	        this.sending = source["sending"];
+	        this.sentFiles = source["sentFiles"];
+	        this.message = source["message"];
+	        this.lastError = source["lastError"];
+	        this.nextRetry = this.convertValues(source["nextRetry"], null);
+	        this.stats = this.convertValues(source["stats"], Stats);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 
 }
 
@@ -2,7 +2,11 @@ module file-transfer-app
 
 go 1.24.2
 
-require github.com/wailsapp/wails/v2 v2.11.0
+require (
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	github.com/wailsapp/wails/v2 v2.11.0
+	golang.org/x/sys v0.38.0
+)
 
 require (
 	github.com/bep/debounce v1.2.1 // indirect
@@ -30,7 +34,6 @@ require (
 	github.com/wailsapp/mimetype v1.4.1 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 )
 
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"file-transfer-app/transfer"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// --------------------------- 二维码 ---------------------------
+const qrCodeSize = 256 // 二维码图片边长（像素）
+
+// qrDataURI 将 text 编码为 PNG 二维码并返回 data URI，可直接用作 <img> 的 src
+func qrDataURI(text string) (string, error) {
+	png, err := qrcode.Encode(text, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return "", fmt.Errorf("生成二维码失败: %v", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// --------------------------- 前端绑定方法 ---------------------------
+// GetShareLink 返回当前的分享地址：浏览器传输服务运行时为其访问地址（含令牌），
+// 否则为本机的连接地址 主机:端口，可直接作为发送时的接收端地址
+func (a *App) GetShareLink() (string, error) {
+	a.mu.Lock()
+	link := a.webLink
+	a.mu.Unlock()
+	if link != "" {
+		return link, nil
+	}
+
+	host, err := transfer.LocalIP()
+	if err != nil {
+		return "", fmt.Errorf("获取本地IP失败: %v", err)
+	}
+	return transfer.ConnectAddr(host), nil
+}
+
+// GetShareQRCode 返回 GetShareLink 地址的二维码（PNG data URI），供手机扫码访问
+func (a *App) GetShareQRCode() (string, error) {
+	link, err := a.GetShareLink()
+	if err != nil {
+		return "", err
+	}
+	return qrDataURI(link)
+}
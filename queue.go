@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"file-transfer-app/transfer"
+)
+
+// --------------------------- 发送队列 ---------------------------
+// jobQueueFile 返回发送队列的保存位置，无法获取配置目录时不持久化
+func jobQueueFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lanfile", "job-queue.json")
+}
+
+// queueObserver 将队列变化转发为 queue-updated 和 queue-job 事件
+type queueObserver struct {
+	app *App
+}
+
+func (o queueObserver) QueueChanged(jobs []transfer.Job) {
+	o.app.emit("queue-updated", jobs)
+}
+
+func (o queueObserver) JobUpdated(job transfer.Job) {
+	o.app.emit("queue-job", job)
+}
+
+// --------------------------- 前端绑定方法 ---------------------------
+// EnqueueSend 将发送任务加入队列，任务在有空闲时按优先级开始，不受正在进行的收发影响。
+// 使用 job 中的 paths、target、options、priority、window 和 retries，返回分配了编号的任务。
+func (a *App) EnqueueSend(job transfer.Job) (transfer.Job, error) {
+	return a.queue.Add(job)
+}
+
+// GetQueue 返回发送队列中的所有任务，按队列顺序排列
+func (a *App) GetQueue() []transfer.Job {
+	return a.queue.Jobs()
+}
+
+// RemoveJob 从队列中移除任务，进行中的任务先被取消
+func (a *App) RemoveJob(id int) error {
+	return a.queue.Remove(id)
+}
+
+// CancelJob 取消任务但保留在队列中，可用 RetryJob 重新开始
+func (a *App) CancelJob(id int) error {
+	return a.queue.Cancel(id)
+}
+
+// RetryJob 将失败或取消的任务重新排队，等待重试的任务立即开始
+func (a *App) RetryJob(id int) error {
+	return a.queue.Retry(id)
+}
+
+// MoveJob 将任务移动到队列中的 index 位置，优先级相同的任务按队列顺序开始
+func (a *App) MoveJob(id, index int) error {
+	return a.queue.Move(id, index)
+}
+
+// SetJobPriority 修改任务的优先级，越大越先开始
+func (a *App) SetJobPriority(id, priority int) error {
+	return a.queue.SetPriority(id, priority)
+}
+
+// SetQueueConcurrency 设置发送队列同时进行的任务数，默认为 1
+func (a *App) SetQueueConcurrency(n int) error {
+	return a.queue.SetConcurrency(n)
+}
+
+// ClearFinishedJobs 移除所有已完成、失败或取消的任务
+func (a *App) ClearFinishedJobs() error {
+	return a.queue.ClearFinished()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"file-transfer-app/transfer"
+)
+
+// --------------------------- 共享与拉取 ---------------------------
+// shareObserver 将其他设备拉取共享时的进度转发为 share-status 和 share-stats 事件，
+// 与本机收发的事件分开，避免干扰主界面的进度
+type shareObserver struct {
+	app *App
+}
+
+func (o shareObserver) StatusChanged(status string) {
+	o.app.emit("share-status", status)
+}
+
+func (o shareObserver) StatsUpdated(stats transfer.Stats) {
+	o.app.emit("share-stats", stats)
+}
+
+// StartSharing 公开 shares 中的只读文件夹供其他设备浏览和拉取，已在共享时只更新共享列表
+func (a *App) StartSharing(shares []transfer.Share) error {
+	a.mu.Lock()
+	server := a.shareServer
+	a.mu.Unlock()
+	if server != nil {
+		return server.SetShares(shares)
+	}
+
+	server = &transfer.ShareServer{
+		Observer: shareObserver{a},
+		Limiters: []*transfer.RateLimiter{a.globalLimiter},
+	}
+	if err := server.SetShares(shares); err != nil {
+		return err
+	}
+	if err := server.Start(fmt.Sprintf(":%d", transfer.SharePort)); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.shareServer = server
+	a.mu.Unlock()
+	return nil
+}
+
+// StopSharing 停止共享，进行中的拉取会被中止
+func (a *App) StopSharing() error {
+	a.mu.Lock()
+	server := a.shareServer
+	a.shareServer = nil
+	a.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Stop()
+}
+
+// GetShares 返回本机当前的共享，未在共享时为空
+func (a *App) GetShares() []transfer.Share {
+	a.mu.Lock()
+	server := a.shareServer
+	a.mu.Unlock()
+	if server == nil {
+		return []transfer.Share{}
+	}
+	return server.Shares()
+}
+
+// ListRemoteShares 返回 target 上本机有权访问的共享名
+func (a *App) ListRemoteShares(target string) ([]string, error) {
+	return transfer.ListShares(target)
+}
+
+// BrowseRemoteShare 列出 target 上共享 share 中 dir 目录的内容，dir 为空表示共享根目录
+func (a *App) BrowseRemoteShare(target, share, dir string) ([]transfer.ShareEntry, error) {
+	return transfer.BrowseShare(target, share, dir)
+}
+
+// Pull 从 target 的共享 share 拉取 paths 中的文件或文件夹到保存目录，paths 为空时拉取整个共享
+func (a *App) Pull(target, share string, paths []string) error {
+	return a.runExclusive("正在拉取...", func() {
+		a.mu.Lock()
+		receiver := &transfer.Receiver{
+			Dir:              a.saveDir,
+			PreserveMetadata: a.preserveMetadata,
+			FreeSpaceMargin:  a.freeSpaceMargin,
+			Observer:         appObserver{a},
+			Hooks:            a.receiveHooks,
+		}
+		a.mu.Unlock()
+		receiver.Limiters = a.beginSession()
+		a.setActive(receiver)
+		receiver.Pull(target, share, paths)
+		if rec := receiver.Record(); !rec.Started.IsZero() {
+			a.addHistory(rec)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"file-transfer-app/transfer"
+
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --------------------------- 文本消息 ---------------------------
+// textHistoryLimit 为保留的最近收到的文本消息数
+const textHistoryLimit = 20
+
+// textObserver 记录收到的文本消息，按设置放入剪贴板，并发送 text-received 事件
+type textObserver struct {
+	app *App
+}
+
+func (o textObserver) TextReceived(msg transfer.TextMessage) {
+	a := o.app
+	a.mu.Lock()
+	a.textHistory = append([]transfer.TextMessage{msg}, a.textHistory...)
+	if len(a.textHistory) > textHistoryLimit {
+		a.textHistory = a.textHistory[:textHistoryLimit]
+	}
+	copyText := a.copyReceivedText
+	a.mu.Unlock()
+
+	if copyText && a.ctx != nil {
+		if err := wailsruntime.ClipboardSetText(a.ctx, msg.Text); err != nil {
+			a.emitStatusUpdate(fmt.Sprintf("写入剪贴板失败: %v", err))
+		}
+	}
+	a.emit("text-received", msg)
+}
+
+// SendText 将 text 作为文本消息发送到自动发现的接收端
+func (a *App) SendText(text string) error {
+	return a.sendTextTo(text, "")
+}
+
+// sendTextTo 在后台发送文本消息到 target，target 为空时自动发现接收端
+func (a *App) sendTextTo(text, target string) error {
+	if text == "" {
+		return fmt.Errorf("文本为空")
+	}
+	return a.runExclusive("正在发送文本...", func() {
+		sender := &transfer.Sender{
+			Observer: appObserver{a},
+			Limiters: a.beginSession(),
+		}
+		a.setActive(sender)
+		sender.SendText(text, target)
+	})
+}
+
+// SendClipboard 读取剪贴板中的文本并发送到自动发现的接收端
+func (a *App) SendClipboard() error {
+	if a.ctx == nil {
+		return fmt.Errorf("剪贴板不可用")
+	}
+	text, err := wailsruntime.ClipboardGetText(a.ctx)
+	if err != nil {
+		return fmt.Errorf("读取剪贴板失败: %v", err)
+	}
+	if text == "" {
+		return fmt.Errorf("剪贴板中没有文本")
+	}
+	return a.SendText(text)
+}
+
+// GetTextHistory 返回最近收到的文本消息，最新的在前
+func (a *App) GetTextHistory() []transfer.TextMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]transfer.TextMessage{}, a.textHistory...)
+}
+
+// SetCopyReceivedText 设置收到文本消息时是否自动放入剪贴板
+func (a *App) SetCopyReceivedText(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.copyReceivedText = enabled
+}
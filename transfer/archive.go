@@ -0,0 +1,523 @@
+package transfer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --------------------------- 归档传输 ---------------------------
+// 文件夹中有大量小文件时，发送端可以把所有根即时打包成一个归档流发送，接收端在 ACCEPT 答复中附带
+// "|ARCHIVE" 表示支持：
+//
+//	ARCHIVE_START|归档文件名|格式|权限(八进制)|修改时间(Unix 纳秒)
+//
+// 其后的数据块格式与流式文件相同。清单中只有归档文件一个根，统计信息仍为打包前的文件数和字节数，
+// 双方都按归档中文件内容的字节数计算进度。接收端默认按原样保存归档；设置 ExtractArchives 时
+// 边接收边解压，得到与逐个发送相同的目录结构。zip 需要随机访问，先接收到临时文件再解压。
+const (
+	ArchiveHeaderPrefix = "ARCHIVE_START"
+	ArchiveCapability   = "ARCHIVE"
+	ArchiveTar          = "tar"
+	ArchiveTarGz        = "tar.gz"
+	ArchiveZip          = "zip"
+	archiveFileMode     = 0644
+	maxZipLinkTarget    = 4096 // zip 中符号链接目标的最大长度
+)
+
+func validArchiveFormat(format string) bool {
+	switch format {
+	case "", ArchiveTar, ArchiveTarGz, ArchiveZip:
+		return true
+	}
+	return false
+}
+
+// archiveName 返回归档文件名：单个根时为根名加扩展名，多个根时为 archive 加扩展名
+func archiveName(roots []sendRoot, format string) string {
+	if len(roots) == 1 {
+		return roots[0].Name + "." + format
+	}
+	return "archive." + format
+}
+
+func formatArchiveHeader(name, format string, mtime time.Time) string {
+	return fmt.Sprintf("%s|%s|%s|%o|%d\n", ArchiveHeaderPrefix, name, format, archiveFileMode, mtime.UnixNano())
+}
+
+// progressReader 在每次读取后报告读取的字节数
+type progressReader struct {
+	r      io.Reader
+	onRead func(n int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.onRead != nil {
+		p.onRead(int64(n))
+	}
+	return n, err
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// --------------------------- 打包发送 ---------------------------
+// archiveWriter 将条目写入归档，content 只在普通文件时不为 nil
+type archiveWriter interface {
+	add(rel string, info os.FileInfo, link string, content io.Reader) error
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+	gz *gzip.Writer // tar.gz 时不为 nil
+}
+
+func (a *tarArchiveWriter) add(rel string, info os.FileInfo, link string, content io.Reader) error {
+	hdr, err := tar.FileInfoHeader(info, filepath.ToSlash(link))
+	if err != nil {
+		return err
+	}
+	hdr.Name = rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// 不携带本机的用户和组，接收端以自身用户创建文件
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if content != nil {
+		if _, err := io.CopyN(a.tw, content, info.Size()); err != nil {
+			return fmt.Errorf("文件在打包时被修改: %v", err)
+		}
+	}
+	return nil
+}
+
+func (a *tarArchiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+	return nil
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchiveWriter) add(rel string, info os.FileInfo, link string, content io.Reader) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else if link == "" {
+		hdr.Method = zip.Deflate
+	}
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	// zip 中的符号链接以链接目标为内容
+	if link != "" {
+		_, err = io.WriteString(w, filepath.ToSlash(link))
+		return err
+	}
+	if content != nil {
+		if _, err := io.CopyN(w, content, info.Size()); err != nil {
+			return fmt.Errorf("文件在打包时被修改: %v", err)
+		}
+	}
+	return nil
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+func newArchiveWriter(w io.Writer, format string) archiveWriter {
+	switch format {
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), gz: gz}
+	case ArchiveZip:
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}
+	default:
+		return &tarArchiveWriter{tw: tar.NewWriter(w)}
+	}
+}
+
+// sendArchive 将各根按过滤规则即时打包为名为 name 的归档流发送，进度按文件内容的字节数计算
+func (s *Sender) sendArchive(conn net.Conn, roots []sendRoot, name string, startTime time.Time, transferredBytes *int64) error {
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write([]byte(formatArchiveHeader(name, s.Archive, time.Now()))); err != nil {
+		return fmt.Errorf("发送文件头失败 %s: %v", name, err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+
+	// 归档写出的小块先在缓冲区中攒成完整的数据块
+	cw := &chunkWriter{conn: conn, w: s.sess.throttledWriter(conn)}
+	bw := bufio.NewWriterSize(cw, streamChunkSize)
+	aw := newArchiveWriter(bw, s.Archive)
+
+	for _, root := range roots {
+		err := s.Filter.walkWarn(root.Path, root.Name, s.sess.warn, func(fullPath, rel string, info os.FileInfo) error {
+			if info.IsDir() {
+				return aw.add(rel, info, "", nil)
+			}
+			if isSymlink(info) {
+				target, err := os.Readlink(fullPath)
+				if err != nil {
+					return fmt.Errorf("读取符号链接失败 %s: %v", fullPath, err)
+				}
+				return aw.add(rel, info, target, nil)
+			}
+
+			s.sess.progress(rel, *transferredBytes, startTime)
+			f, err := os.Open(fullPath)
+			if err != nil {
+				return fmt.Errorf("打开文件失败 %s: %v", fullPath, err)
+			}
+			defer f.Close()
+			err = aw.add(rel, info, "", &progressReader{r: f, onRead: func(n int64) {
+				*transferredBytes += n
+				s.sess.progress(rel, *transferredBytes, startTime)
+			}})
+			if err != nil {
+				return fmt.Errorf("打包文件失败 %s: %v", rel, err)
+			}
+			s.sess.mu.Lock()
+			s.sess.stats.CompletedFiles++
+			s.sess.mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("发送文件内容失败 %s: %v", name, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("发送文件内容失败 %s: %v", name, err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("发送文件内容失败 %s: %v", name, err)
+	}
+	s.sess.progress("", *transferredBytes, startTime)
+	return nil
+}
+
+// --------------------------- 接收归档 ---------------------------
+// receiveArchive 接收归档流，按 ExtractArchives 原样保存或解压到 destDir。
+// onChunk 报告文件内容的字节数，fileDone 在每个保存或解压出的文件完成时调用。
+func (r *Receiver) receiveArchive(hdr entryHeader, reader *bufio.Reader, conn net.Conn, destDir string, onChunk func(written int64), fileDone func(path, rel string, size int64)) error {
+	defer conn.SetReadDeadline(time.Time{})
+	src := r.sess.throttledReader(&chunkReader{reader: reader, conn: conn})
+
+	if r.ExtractArchives && hdr.ArchiveFormat != ArchiveZip {
+		ex := &archiveExtractor{r: r, destDir: destDir, onChunk: onChunk, fileDone: fileDone}
+		err := ex.extractTar(src, hdr.ArchiveFormat)
+		if err == nil {
+			// 读完 tar 结尾和 gzip 尾部之后剩余的数据块
+			_, err = io.Copy(io.Discard, src)
+		}
+		ex.finish()
+		return err
+	}
+
+	targetPath, err := confinedJoin(destDir, hdr.RelPath)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(targetPath), 0755)
+	partialPath := partialPathFor(targetPath)
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	saved := &countingWriter{w: file}
+
+	if hdr.ArchiveFormat == ArchiveZip {
+		// zip 按归档字节计算进度，需要解压时从临时文件解压后删除
+		if _, err = io.Copy(saved, &progressReader{r: src, onRead: onChunk}); err == nil && r.ExtractArchives {
+			r.sess.status("正在解压 " + hdr.RelPath)
+			ex := &archiveExtractor{r: r, destDir: destDir, fileDone: fileDone}
+			err = ex.extractZip(file, saved.n)
+			ex.finish()
+			file.Close()
+			os.Remove(partialPath)
+			return err
+		}
+	} else {
+		// 保存原始字节的同时解析 tar 条目，按文件内容计算进度
+		tee := io.TeeReader(src, saved)
+		if err = scanTar(tee, hdr.ArchiveFormat, onChunk); err == nil {
+			_, err = io.Copy(io.Discard, tee)
+		}
+	}
+	if err == nil {
+		err = commitPartial(file, partialPath, targetPath, saved.n)
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	if r.PreserveMetadata {
+		if err := applyMetadata(targetPath, hdr); err != nil {
+			r.sess.warn(err.Error())
+		}
+	}
+	fileDone(targetPath, hdr.RelPath, saved.n)
+	return nil
+}
+
+// openTar 按格式打开 tar 流
+func openTar(src io.Reader, format string) (*tar.Reader, error) {
+	if format == ArchiveTarGz {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("读取归档失败: %v", err)
+		}
+		return tar.NewReader(gz), nil
+	}
+	return tar.NewReader(src), nil
+}
+
+// scanTar 读完 tar 流中的所有条目，只统计文件内容的字节数
+func scanTar(src io.Reader, format string, onChunk func(written int64)) error {
+	tr, err := openTar(src, format)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := tr.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("读取归档失败: %v", err)
+		}
+		if _, err := io.Copy(io.Discard, &progressReader{r: tr, onRead: onChunk}); err != nil {
+			return fmt.Errorf("读取归档失败: %v", err)
+		}
+	}
+}
+
+// archiveExtractor 将归档条目解压到保存目录，目录属性在所有条目写完后恢复
+type archiveExtractor struct {
+	r        *Receiver
+	destDir  string
+	onChunk  func(written int64)
+	fileDone func(path, rel string, size int64)
+	dirs     []extractedDir
+	files    map[string]int64 // 本归档中已解压的普通文件及其大小，硬链接只能指向这些文件
+}
+
+type extractedDir struct {
+	path string
+	hdr  entryHeader
+}
+
+func (ex *archiveExtractor) extractTar(src io.Reader, format string) error {
+	tr, err := openTar(src, format)
+	if err != nil {
+		return err
+	}
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取归档失败: %v", err)
+		}
+		h := entryHeader{
+			RelPath: strings.TrimSuffix(th.Name, "/"),
+			Size:    th.Size,
+			Mode:    th.FileInfo().Mode().Perm(),
+			ModTime: th.ModTime,
+			HasMeta: true,
+		}
+		switch th.Typeflag {
+		case tar.TypeDir:
+			h.IsDir = true
+		case tar.TypeSymlink:
+			h.IsLink, h.LinkTarget = true, th.Linkname
+		case tar.TypeLink:
+			// 越界或无效的硬链接只跳过，与符号链接一致
+			if err := ex.hardLink(h.RelPath, th.Linkname); err != nil {
+				ex.r.sess.status(err.Error())
+			}
+			continue
+		case tar.TypeReg:
+		default:
+			ex.r.sess.status("跳过不支持的归档条目: " + th.Name)
+			continue
+		}
+		if err := ex.extract(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (ex *archiveExtractor) extractZip(f *os.File, size int64) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return fmt.Errorf("读取归档失败: %v", err)
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		h := entryHeader{
+			RelPath: strings.TrimSuffix(zf.Name, "/"),
+			Size:    int64(zf.UncompressedSize64),
+			Mode:    mode.Perm(),
+			ModTime: zf.Modified,
+			HasMeta: true,
+			IsDir:   mode.IsDir(),
+		}
+		if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+			ex.r.sess.status("跳过不支持的归档条目: " + zf.Name)
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("读取归档失败: %v", err)
+		}
+		if mode&os.ModeSymlink != 0 {
+			target, err := io.ReadAll(io.LimitReader(rc, maxZipLinkTarget))
+			if err != nil {
+				rc.Close()
+				return fmt.Errorf("读取归档失败: %v", err)
+			}
+			h.IsLink, h.LinkTarget = true, string(target)
+		}
+		err = ex.extract(h, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extract 写出一个条目；越界或无法创建的符号链接只跳过，与逐个接收时一致
+func (ex *archiveExtractor) extract(h entryHeader, content io.Reader) error {
+	targetPath, err := confinedJoin(ex.destDir, h.RelPath)
+	if err != nil {
+		return err
+	}
+	if h.IsDir {
+		if err := os.MkdirAll(targetPath, 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		ex.dirs = append(ex.dirs, extractedDir{path: targetPath, hdr: h})
+		return nil
+	}
+	if h.IsLink {
+		if err := createConfinedSymlink(ex.destDir, targetPath, h.LinkTarget); err != nil {
+			ex.r.sess.status(err.Error())
+		}
+		return nil
+	}
+
+	os.MkdirAll(filepath.Dir(targetPath), 0755)
+	partialPath := partialPathFor(targetPath)
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	_, err = io.Copy(file, &progressReader{r: content, onRead: ex.onChunk})
+	if err == nil {
+		err = commitPartial(file, partialPath, targetPath, h.Size)
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	if ex.r.PreserveMetadata {
+		if err := applyMetadata(targetPath, h); err != nil {
+			ex.r.sess.warn(err.Error())
+		}
+	}
+	if ex.files == nil {
+		ex.files = make(map[string]int64)
+	}
+	ex.files[targetPath] = h.Size
+	ex.fileDone(targetPath, h.RelPath, h.Size)
+	return nil
+}
+
+// hardLink 将归档中的硬链接 rel 创建为指向 linkname 的链接。
+// linkname 必须是本归档中先前解压的普通文件，不能指向保存目录中原有的文件或保存目录之外。
+func (ex *archiveExtractor) hardLink(rel, linkname string) error {
+	src, err := confinedJoin(ex.destDir, linkname)
+	if err != nil {
+		return fmt.Errorf("跳过越界的硬链接 %s: %v", rel, err)
+	}
+	size, ok := ex.files[src]
+	if fi, err := os.Lstat(src); err != nil || !fi.Mode().IsRegular() {
+		ok = false
+	}
+	if !ok {
+		return fmt.Errorf("跳过指向归档外文件的硬链接: %s -> %s", rel, linkname)
+	}
+	target, err := confinedJoin(ex.destDir, rel)
+	if err != nil {
+		return fmt.Errorf("跳过越界的硬链接 %s: %v", rel, err)
+	}
+	if target == src {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+		os.Remove(target)
+	}
+	if err := os.Link(src, target); err != nil {
+		return fmt.Errorf("创建硬链接失败 %s: %v", rel, err)
+	}
+	ex.files[target] = size
+	ex.fileDone(target, rel, size)
+	return nil
+}
+
+// finish 倒序恢复目录属性，保证子目录先于父目录处理
+func (ex *archiveExtractor) finish() {
+	if !ex.r.PreserveMetadata {
+		return
+	}
+	for i := len(ex.dirs) - 1; i >= 0; i-- {
+		if err := applyMetadata(ex.dirs[i].path, ex.dirs[i].hdr); err != nil {
+			ex.r.sess.warn(err.Error())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package transfer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry 为构造归档用的条目，link 为链接目标
+type tarEntry struct {
+	name     string
+	typeflag byte
+	link     string
+	body     string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.link, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestExtractor(dest string) *archiveExtractor {
+	r := &Receiver{Dir: dest}
+	r.sess = newSession(nil, nil)
+	return &archiveExtractor{r: r, destDir: dest, onChunk: func(int64) {}, fileDone: func(string, string, int64) {}}
+}
+
+// 构造的归档不能通过路径、符号链接或硬链接写出或读取保存目录之外的文件
+func TestExtractMaliciousTar(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	secret := filepath.Join(outer, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := buildTar(t, []tarEntry{
+		{name: "a/", typeflag: tar.TypeDir},
+		{name: "a/b/", typeflag: tar.TypeDir},
+		{name: "a/b/up", typeflag: tar.TypeSymlink, link: ".."},
+		{name: "esc", typeflag: tar.TypeSymlink, link: "a/b/up/../.."},
+		{name: "abs", typeflag: tar.TypeSymlink, link: outer},
+		{name: "out", typeflag: tar.TypeSymlink, link: "../" + filepath.Base(outer)},
+		{name: "esc/x", typeflag: tar.TypeReg, body: "X"},
+		{name: "abs/y", typeflag: tar.TypeReg, body: "Y"},
+		{name: "hard-secret", typeflag: tar.TypeLink, link: "../secret.txt"},
+		{name: "hard-abs", typeflag: tar.TypeLink, link: secret},
+		{name: "f.txt", typeflag: tar.TypeReg, body: "F"},
+		{name: "sub/hard-f", typeflag: tar.TypeLink, link: "f.txt"},
+	})
+	ex := newTestExtractor(dest)
+	err := ex.extractTar(bytes.NewReader(archive), ArchiveTar)
+	t.Logf("解压结果: %v", err)
+
+	for _, name := range []string{"x", "y"} {
+		if _, err := os.Lstat(filepath.Join(outer, name)); err == nil {
+			t.Errorf("文件写到了保存目录之外: %s", name)
+		}
+	}
+	if data, _ := os.ReadFile(secret); string(data) != "secret" {
+		t.Errorf("保存目录之外的文件被修改: %q", data)
+	}
+	for _, name := range []string{"esc", "abs", "out"} {
+		if fi, err := os.Lstat(filepath.Join(dest, name)); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("创建了越界的符号链接 %s", name)
+		}
+	}
+	for _, name := range []string{"hard-secret", "hard-abs"} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); err == nil {
+			t.Errorf("创建了指向保存目录之外的硬链接 %s", name)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "sub", "hard-f")); string(data) != "F" {
+		t.Errorf("归档内的硬链接 = %q，应指向 f.txt", data)
+	}
+}
+
+func TestExtractMaliciousTarPath(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	archive := buildTar(t, []tarEntry{{name: "../evil.txt", typeflag: tar.TypeReg, body: "E"}})
+	if err := newTestExtractor(dest).extractTar(bytes.NewReader(archive), ArchiveTar); err == nil {
+		t.Error("越界的路径应导致解压失败")
+	}
+	if _, err := os.Lstat(filepath.Join(outer, "evil.txt")); err == nil {
+		t.Error("文件写到了保存目录之外")
+	}
+}
+
+func TestExtractMaliciousZip(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	link := &zip.FileHeader{Name: "esc"}
+	link.SetMode(os.ModeSymlink | 0777)
+	w, err := zw.CreateHeader(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(".."))
+	w, err = zw.Create("esc/z.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Z"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "a.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = newTestExtractor(dest).extractZip(f, int64(buf.Len()))
+	t.Logf("解压结果: %v", err)
+
+	if fi, err := os.Lstat(filepath.Join(dest, "esc")); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		t.Error("创建了越界的符号链接 esc")
+	}
+	if _, err := os.Lstat(filepath.Join(outer, "z.txt")); err == nil {
+		t.Error("文件写到了保存目录之外")
+	}
+}
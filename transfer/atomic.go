@@ -0,0 +1,118 @@
+package transfer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --------------------------- 原子写入 ---------------------------
+// 接收中的文件先写入同目录下的隐藏临时文件 ".<文件名>.lanfile.partial"，
+// 校验大小（有校验和时还校验内容）并落盘后再重命名为最终文件名，崩溃时不会留下看似完整的半成品。
+// 后缀带有本程序的标记，清理时不会误删其他程序的临时文件。
+const PartialSuffix = ".lanfile.partial"
+
+func partialPathFor(targetPath string) string {
+	return filepath.Join(filepath.Dir(targetPath), "."+filepath.Base(targetPath)+PartialSuffix)
+}
+
+func isPartialName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, PartialSuffix) && len(name) > len(PartialSuffix)+1
+}
+
+// commitPartial 校验临时文件大小、同步到磁盘并重命名为 targetPath，无论成功与否都会关闭 f
+func commitPartial(f *os.File, partialPath, targetPath string, size int64) error {
+	return commitPartialSum(f, partialPath, targetPath, size, "")
+}
+
+// commitPartialSum 与 commitPartial 相同，sum 不为空时还在重命名前校验临时文件的 SHA-256（十六进制）
+func commitPartialSum(f *os.File, partialPath, targetPath string, size int64, sum string) error {
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("获取文件信息失败: %v", err)
+	}
+	if fi.Size() != size {
+		f.Close()
+		return fmt.Errorf("文件大小不符: 期望 %d 字节，实际 %d 字节", size, fi.Size())
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("同步文件失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("关闭文件失败: %v", err)
+	}
+	if sum != "" {
+		got, err := hashFile(partialPath)
+		if err != nil {
+			return err
+		}
+		if got != sum {
+			return fmt.Errorf("文件校验和不符")
+		}
+	}
+	if err := os.Rename(partialPath, targetPath); err != nil {
+		return fmt.Errorf("重命名文件失败: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic 通过临时文件写入 data 并重命名为 target，中断时不会留下不完整的文件
+func writeFileAtomic(target string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	partialPath := partialPathFor(target)
+	f, err := os.Create(partialPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(partialPath)
+		return err
+	}
+	if err := commitPartial(f, partialPath, target, int64(len(data))); err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+	return nil
+}
+
+// cleanupPartials 删除本次会话各发送根上次中断遗留的临时文件，返回删除的数量。
+// 文件夹根递归检查，不跟随符号链接，也不触及本次会话之外的路径。
+func cleanupPartials(dir string, roots []sendRoot) int {
+	removed := 0
+	remove := func(path string) {
+		if fi, err := os.Lstat(path); err == nil && fi.Mode().IsRegular() && os.Remove(path) == nil {
+			removed++
+		}
+	}
+	for _, root := range roots {
+		rootPath, err := confinedJoin(dir, root.Name)
+		if err != nil {
+			continue
+		}
+		remove(partialPathFor(rootPath))
+		if !root.IsDir {
+			continue
+		}
+		// WalkDir 不进入符号链接指向的目录，遍历始终位于 rootPath 之内
+		filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && isPartialName(d.Name()) {
+				remove(path)
+			}
+			return nil
+		})
+	}
+	return removed
+}
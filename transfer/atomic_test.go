@@ -0,0 +1,97 @@
+package transfer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanupPartials(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	writeTree(t, outer, map[string]string{".f.txt" + PartialSuffix: "x"})
+	writeTree(t, dest, map[string]string{
+		".a.txt" + PartialSuffix:               "x", // 文件根的临时文件
+		"dir/.b.txt" + PartialSuffix:           "x", // 文件夹根第一层
+		"dir/sub/.c.txt" + PartialSuffix:       "x", // 中断的文件夹传输留在深层的
+		"dir/sub/deep/.g.txt" + PartialSuffix:  "x",
+		"dir/.d.txt.partial":                   "x", // 其他程序的临时文件
+		".other.txt" + PartialSuffix:           "x", // 不属于本次会话
+		"other/.e.txt" + PartialSuffix:         "x",
+		"dir/.keep" + PartialSuffix + "/inner": "x", // 同名目录不删除
+	})
+	// 指向保存目录之外的符号链接不被跟随
+	if err := os.Symlink(outer, filepath.Join(dest, "dir", "sub", "out")); err != nil {
+		t.Fatal(err)
+	}
+	roots := []sendRoot{{Name: "a.txt"}, {Name: "dir", IsDir: true}}
+	if removed := cleanupPartials(dest, roots); removed != 4 {
+		t.Errorf("删除了 %d 个临时文件，应为 4", removed)
+	}
+
+	for rel, want := range map[string]bool{
+		".a.txt" + PartialSuffix:              false,
+		"dir/.b.txt" + PartialSuffix:          false,
+		"dir/sub/.c.txt" + PartialSuffix:      false,
+		"dir/sub/deep/.g.txt" + PartialSuffix: false,
+		"dir/.d.txt.partial":                  true,
+		".other.txt" + PartialSuffix:          true,
+		"other/.e.txt" + PartialSuffix:        true,
+		"dir/.keep" + PartialSuffix:           true,
+	} {
+		_, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(rel)))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s 存在 = %v，应为 %v", rel, exists, want)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(outer, ".f.txt"+PartialSuffix)); err != nil {
+		t.Errorf("删除了保存目录之外的文件: %v", err)
+	}
+}
+
+func TestCleanupPartialsSkippedForOutput(t *testing.T) {
+	dest := t.TempDir()
+	partial := filepath.Join(dest, ".a.txt"+PartialSuffix)
+	writeTree(t, dest, map[string]string{".a.txt" + PartialSuffix: "x"})
+
+	var out bytes.Buffer
+	r := &Receiver{Dir: dest, Output: &out}
+	stream := "a.txt|FILE\n" + StatsMarker + "|1|2\n" + FileHeaderPrefix + "|a.txt|2\nhi" + EndMarker + "\n"
+	if err := receiveRaw(t, r, stream); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi" {
+		t.Errorf("Output = %q", out.String())
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("写入 Output 时不应清理保存目录: %v", err)
+	}
+}
+
+func TestCommitPartialSum(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "f.txt")
+	write := func() *os.File {
+		f, err := os.Create(partialPathFor(target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("hello")
+		return f
+	}
+
+	if err := commitPartialSum(write(), partialPathFor(target), target, 5, "00"); err == nil {
+		t.Error("校验和不符时应失败")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("校验失败后不应出现最终文件")
+	}
+
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if err := commitPartialSum(write(), partialPathFor(target), target, 5, sum); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "hello" {
+		t.Errorf("内容 = %q", data)
+	}
+}
@@ -0,0 +1,94 @@
+package transfer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// --------------------------- 缓冲区池 ---------------------------
+// bufferPool 为需要在用户态处理数据的路径提供共享缓冲区，避免每个文件分配一次 BufferSize
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, BufferSize)
+		return &buf
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(buf *[]byte) {
+	bufferPool.Put(buf)
+}
+
+// --------------------------- 零拷贝传输工具 ---------------------------
+// copyChunked 以 BufferSize 为单位从 src 向 dst 拷贝 n 字节，每拷贝一块调用一次 onChunk。
+// dst/src 为 *os.File 与 *net.TCPConn 时 Go 运行时会选择 sendfile/splice，
+// 否则回退到共享缓冲区。每块开始前刷新 conn 的读写超时，避免网络阻塞。
+func copyChunked(conn net.Conn, dst io.Writer, src io.Reader, n int64, onChunk func(written int64)) (int64, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	defer conn.SetDeadline(time.Time{})
+
+	var total int64
+	for total < n {
+		// 每块重新判断限速状态，使传输中调整限速能及时生效
+		d, s, limited := unwrapIdleLimits(dst, src)
+		chunk := n - total
+		if chunk > BufferSize {
+			chunk = BufferSize
+		}
+		if limited && chunk > rateLimitChunkSize {
+			chunk = rateLimitChunkSize
+		}
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+		written, err := io.CopyBuffer(d, io.LimitReader(s, chunk), *buf)
+		total += written
+		if written > 0 && onChunk != nil {
+			onChunk(written)
+		}
+		if err != nil {
+			return total, err
+		}
+		if written < chunk {
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+	return total, nil
+}
+
+// sendFileContent 将 src 的 size 字节经 dst（连接或其限速包装）写出，纯 TCP 连接上会走 sendfile
+func sendFileContent(conn net.Conn, dst io.Writer, src io.Reader, size int64, onChunk func(written int64)) (int64, error) {
+	return copyChunked(conn, dst, src, size, onChunk)
+}
+
+// receiveFileContent 从连接读取 size 字节写入 dst。
+// 先写出 bufio.Reader 中已缓冲的数据，再直接从 src（连接或其限速包装）读取，使 Linux 上可以走 splice。
+func receiveFileContent(dst io.Writer, reader *bufio.Reader, conn net.Conn, src io.Reader, size int64, onChunk func(written int64)) (int64, error) {
+	var total int64
+
+	if buffered := int64(reader.Buffered()); buffered > 0 && size > 0 {
+		if buffered > size {
+			buffered = size
+		}
+		written, err := io.CopyN(dst, reader, buffered)
+		total += written
+		if written > 0 && onChunk != nil {
+			onChunk(written)
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if total == size {
+		return total, nil
+	}
+
+	written, err := copyChunked(conn, dst, src, size-total, onChunk)
+	return total + written, err
+}
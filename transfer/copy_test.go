@@ -0,0 +1,46 @@
+package transfer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// plainConn 隐藏 *net.TCPConn 的 ReadFrom/WriteTo，使拷贝回退到用户态缓冲区，作为零拷贝前的对照
+type plainConn struct {
+	net.Conn
+}
+
+// BenchmarkSend 在回环连接上发送一个 64MB 文件，比较零拷贝与用户态缓冲区拷贝的吞吐量和内存分配
+func BenchmarkSend(b *testing.B) {
+	const size = 64 << 20
+	src := filepath.Join(b.TempDir(), "data.bin")
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name string
+		wrap func(net.Conn) net.Conn
+	}{
+		{"zerocopy", nil},
+		{"buffered", func(c net.Conn) net.Conn { return plainConn{c} }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			dest := b.TempDir()
+			b.ReportAllocs()
+			b.SetBytes(size)
+			for b.Loop() {
+				sendErr, recvErr := sendLoopback(b, &Sender{}, &Receiver{Dir: dest}, []string{src}, bc.wrap)
+				if sendErr != nil || recvErr != nil {
+					b.Fatalf("发送: %v, 接收: %v", sendErr, recvErr)
+				}
+			}
+		})
+	}
+}
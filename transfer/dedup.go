@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// --------------------------- 内容去重 ---------------------------
+// 接收端在 ACCEPT 答复中附带 "|DEDUP" 表示支持去重。发送端扫描时对大小相同的文件计算 SHA-256，
+// 内容重复的文件只发送第一份，之后的副本改用去重头，不附带内容：
+//
+//	DUP_START|相对路径|大小|权限(八进制)|修改时间(Unix 纳秒)|原文件相对路径
+//
+// 原文件必须是本次会话中先前已接收的文件，接收端从它克隆（支持 reflink 时）或复制出副本。
+const (
+	DupHeaderPrefix = "DUP_START"
+	DedupCapability = "DEDUP"
+)
+
+// Duplicate 记录一个由已接收的原文件复制得到的副本
+type Duplicate struct {
+	Path   string `json:"path"`   // 副本的相对路径
+	Source string `json:"source"` // 内容相同的原文件的相对路径
+}
+
+func formatDupHeader(rel string, info os.FileInfo, source string) string {
+	return fmt.Sprintf("%s|%s|%d|%o|%d|%s\n", DupHeaderPrefix, rel, info.Size(), info.Mode().Perm(), info.ModTime().UnixNano(), source)
+}
+
+// findDuplicates 按发送顺序遍历各根目录，返回内容与先出现的文件相同的文件（相对路径 → 原文件相对路径）。
+// 只对大小相同的文件计算哈希，空文件不参与去重。
+func findDuplicates(roots []sendRoot, filter *Filter) (map[string]string, error) {
+	type candidate struct {
+		fullPath, rel string
+	}
+	bySize := make(map[int64][]candidate)
+	var sizes []int64
+	for _, root := range roots {
+		err := filter.walk(root.Path, root.Name, func(fullPath, rel string, info os.FileInfo) error {
+			if !info.Mode().IsRegular() || info.Size() == 0 {
+				return nil
+			}
+			if _, ok := bySize[info.Size()]; !ok {
+				sizes = append(sizes, info.Size())
+			}
+			bySize[info.Size()] = append(bySize[info.Size()], candidate{fullPath, rel})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dups := make(map[string]string)
+	for _, size := range sizes {
+		group := bySize[size]
+		if len(group) < 2 {
+			continue
+		}
+		first := make(map[string]string)
+		for _, c := range group {
+			sum, err := hashFile(c.fullPath)
+			if err != nil {
+				return nil, fmt.Errorf("读取文件失败 %s: %v", c.fullPath, err)
+			}
+			if source, ok := first[sum]; ok {
+				dups[c.rel] = source
+			} else {
+				first[sum] = c.rel
+			}
+		}
+	}
+	return dups, nil
+}
+
+// sendDuplicate 发送去重头，由接收端从原文件复制内容
+func (s *Sender) sendDuplicate(conn net.Conn, rel string, fi os.FileInfo, source string, startTime time.Time, transferredBytes *int64) error {
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetWriteDeadline(time.Time{})
+	if _, err := conn.Write([]byte(formatDupHeader(rel, fi, source))); err != nil {
+		return fmt.Errorf("发送文件头失败 %s: %v", rel, err)
+	}
+
+	// 副本不占传输量，但计入进度
+	*transferredBytes += fi.Size()
+	s.sess.update(func(st *Stats) {
+		st.CompletedFiles++
+		st.SavedBytes += fi.Size()
+	})
+	s.sess.progress("", *transferredBytes, startTime)
+	return nil
+}
+
+// copyDuplicate 将 sourcePath 的内容写入空文件 dst，支持时使用 reflink 克隆以共享磁盘块
+func copyDuplicate(dst *os.File, sourcePath string) error {
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("打开原文件失败: %v", err)
+	}
+	defer src.Close()
+	if cloneFile(dst, src) == nil {
+		return nil
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("复制原文件失败: %v", err)
+	}
+	return nil
+}
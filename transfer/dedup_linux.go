@@ -0,0 +1,14 @@
+//go:build linux
+
+package transfer
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile 使用 FICLONE 让 dst 与 src 共享磁盘块（btrfs、XFS 等），不支持时返回错误
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
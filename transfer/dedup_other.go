@@ -0,0 +1,13 @@
+//go:build !linux
+
+package transfer
+
+import (
+	"fmt"
+	"os"
+)
+
+// cloneFile 在不支持 reflink 的平台上总是返回错误，由调用方改为复制
+func cloneFile(dst, src *os.File) error {
+	return fmt.Errorf("不支持 reflink")
+}
@@ -0,0 +1,85 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, filepath.Join(dir, "a"), map[string]string{
+		"1.txt":     "same",
+		"2.txt":     "same",
+		"3.txt":     "diff", // 大小相同但内容不同
+		"sub/4.txt": "same",
+		"empty1":    "",
+		"empty2":    "",
+	})
+	writeTree(t, filepath.Join(dir, "b"), map[string]string{"5.txt": "diff", "6.txt": "unique"})
+	filter, err := NewFilter(SendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := buildSendRoots([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dups, err := findDuplicates(roots, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a/2.txt": "a/1.txt", "a/sub/4.txt": "a/1.txt", "b/5.txt": "a/3.txt"}
+	if len(dups) != len(want) {
+		t.Errorf("dups = %v，应为 %v", dups, want)
+	}
+	for rel, source := range want {
+		if dups[rel] != source {
+			t.Errorf("%s 的原文件 = %q，应为 %q", rel, dups[rel], source)
+		}
+	}
+}
+
+// 启用去重后副本由接收端从原文件复制，内容与源文件一致
+func TestDedupRoundTrip(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "data")
+	files := map[string]string{"x.bin": "payload", "copy/x.bin": "payload", "copy/y.bin": "payload", "z.bin": "other"}
+	writeTree(t, src, files)
+
+	dest := t.TempDir()
+	r := &Receiver{Dir: dest}
+	sendErr, recvErr := sendLoopback(t, &Sender{Dedup: true}, r, []string{src}, nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("发送: %v, 接收: %v", sendErr, recvErr)
+	}
+	for rel, content := range files {
+		if data, _ := os.ReadFile(filepath.Join(dest, "data", filepath.FromSlash(rel))); string(data) != content {
+			t.Errorf("%s = %q，应为 %q", rel, data, content)
+		}
+	}
+	if dups := r.Record().Dups; len(dups) != 2 {
+		t.Errorf("去重副本 = %+v，应为 2 个", dups)
+	}
+}
+
+// 去重头只能引用本次会话已接收的文件，不能借此复制接收端已有的文件
+func TestDupSourceNotReceived(t *testing.T) {
+	dest := t.TempDir()
+	writeTree(t, dest, map[string]string{"data/private.txt": "private"})
+
+	stream := "data|DIR\n" + StatsMarker + "|1|7\n" +
+		DirHeaderPrefix + "|data|755|0\n" +
+		DupHeaderPrefix + "|data/leak.txt|7|644|0|data/private.txt\n" +
+		EndMarker + "\n"
+	if err := receiveRaw(t, &Receiver{Dir: dest}, stream); err == nil || !strings.Contains(err.Error(), "原文件未接收") {
+		t.Errorf("原文件未接收时应失败: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "data", "leak.txt")); !os.IsNotExist(err) {
+		t.Error("不应创建副本")
+	}
+	if _, err := os.Lstat(partialPathFor(filepath.Join(dest, "data", "leak.txt"))); !os.IsNotExist(err) {
+		t.Error("不应留下临时文件")
+	}
+}
@@ -0,0 +1,438 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------- 差异传输协议 ---------------------------
+// 接收端在 ACCEPT 答复中附带 "|DELTA" 表示支持差异传输。发送端对较大的文件改用差异文件头：
+//
+//	DELTA_START|相对路径|大小|权限(八进制)|修改时间(Unix 纳秒)
+//
+// 接收端随即答复已有同名文件的块签名 "SIGS|块大小|块数|原文件大小"，其后为块数个
+// 4 字节弱校验和（大端）加 16 字节强校验和；没有可复用的文件时块数为 0。
+// 发送端按滚动校验和查找可复用的块，依次发送操作：
+//
+//	'L' + 长度(uint32 大端) + 数据   字面数据
+//	'B' + 块序号(uint64 大端)        复制接收端原文件中的一块
+//	'E' + 新文件的 SHA-256            结束，接收端据此校验重建结果
+const (
+	DeltaHeaderPrefix = "DELTA_START"
+	DeltaCapability   = "DELTA"
+	SignatureMarker   = "SIGS"
+	deltaMinSize      = 1024 * 1024 // 小于该大小的文件直接完整发送
+	deltaMinBlock     = 4 * 1024
+	deltaMaxBlock     = 1024 * 1024
+	deltaMaxBlocks    = 1 << 20     // 块签名的最大块数（约 20MB），原文件更大时完整发送
+	deltaMaxLiteral   = 1024 * 1024 // 单个字面数据操作的最大长度
+	deltaStrongLen    = 16
+
+	deltaOpLiteral = 'L'
+	deltaOpBlock   = 'B'
+	deltaOpEnd     = 'E'
+)
+
+// blockSig 为原文件中一块的签名
+type blockSig struct {
+	weak   uint32
+	strong [deltaStrongLen]byte
+}
+
+func formatDeltaHeader(rel string, info os.FileInfo) string {
+	return fmt.Sprintf("%s|%s|%d|%o|%d\n", DeltaHeaderPrefix, rel, info.Size(), info.Mode().Perm(), info.ModTime().UnixNano())
+}
+
+// deltaBlockSize 按原文件大小选择块大小：约为大小的平方根，按 1KB 对齐
+func deltaBlockSize(size int64) int {
+	bs := int(math.Sqrt(float64(size))) &^ 1023
+	if bs < deltaMinBlock {
+		return deltaMinBlock
+	}
+	if bs > deltaMaxBlock {
+		return deltaMaxBlock
+	}
+	return bs
+}
+
+// weakSum 计算 rsync 风格的弱校验和的两个分量
+func weakSum(p []byte) (a, b uint32) {
+	n := uint32(len(p))
+	for i, c := range p {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+func strongSum(p []byte) (s [deltaStrongLen]byte) {
+	h := sha256.Sum256(p)
+	copy(s[:], h[:])
+	return s
+}
+
+// --------------------------- 接收端 ---------------------------
+// writeSignatures 计算 basisPath 的块签名并发送给发送端，返回打开的原文件（不存在时为 nil）和块参数
+func writeSignatures(w io.Writer, basisPath string) (basis *os.File, bs, count int, basisSize int64, err error) {
+	bw := bufio.NewWriter(w)
+	if f, openErr := os.Open(basisPath); openErr == nil {
+		if fi, statErr := f.Stat(); statErr == nil && fi.Mode().IsRegular() && fi.Size() > 0 {
+			basis, basisSize = f, fi.Size()
+		} else {
+			f.Close()
+		}
+	}
+	if basis != nil && basisSize > int64(deltaMaxBlocks)*deltaMaxBlock {
+		basis.Close()
+		basis, basisSize = nil, 0
+	}
+	if basis == nil {
+		fmt.Fprintf(bw, "%s|0|0|0\n", SignatureMarker)
+		return nil, 0, 0, 0, bw.Flush()
+	}
+
+	bs = deltaBlockSize(basisSize)
+	count = int((basisSize + int64(bs) - 1) / int64(bs))
+	fmt.Fprintf(bw, "%s|%d|%d|%d\n", SignatureMarker, bs, count, basisSize)
+	buf := make([]byte, bs)
+	r := bufio.NewReaderSize(basis, BufferSize)
+	for i := 0; i < count; i++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			basis.Close()
+			return nil, 0, 0, 0, fmt.Errorf("读取原文件失败: %v", err)
+		}
+		a, b := weakSum(buf[:n])
+		binary.Write(bw, binary.BigEndian, a|b<<16)
+		strong := strongSum(buf[:n])
+		bw.Write(strong[:])
+	}
+	if err := bw.Flush(); err != nil {
+		basis.Close()
+		return nil, 0, 0, 0, err
+	}
+	return basis, bs, count, basisSize, nil
+}
+
+// applyDelta 读取发送端的操作流，用字面数据和原文件中的块重建新文件写入 out，返回字面数据的字节数。
+// data 为读取字面数据使用的（可能限速的）读取端，需与 reader 读取同一连接。
+func applyDelta(reader *bufio.Reader, data io.Reader, out io.Writer, basis *os.File, bs, count int, basisSize, size int64, onChunk func(int64)) (int64, error) {
+	hash := sha256.New()
+	bw := bufio.NewWriterSize(out, BufferSize)
+	w := io.MultiWriter(bw, hash)
+	var written, literal int64
+
+	for {
+		op, err := reader.ReadByte()
+		if err != nil {
+			return literal, fmt.Errorf("读取差异数据失败: %v", err)
+		}
+		switch op {
+		case deltaOpLiteral:
+			var n uint32
+			if err := binary.Read(reader, binary.BigEndian, &n); err != nil {
+				return literal, fmt.Errorf("读取差异数据失败: %v", err)
+			}
+			if written+int64(n) > size {
+				return literal, fmt.Errorf("差异数据超出文件大小")
+			}
+			if _, err := io.CopyN(w, data, int64(n)); err != nil {
+				return literal, fmt.Errorf("读取差异数据失败: %v", err)
+			}
+			written += int64(n)
+			literal += int64(n)
+			onChunk(int64(n))
+		case deltaOpBlock:
+			var idx uint64
+			if err := binary.Read(reader, binary.BigEndian, &idx); err != nil {
+				return literal, fmt.Errorf("读取差异数据失败: %v", err)
+			}
+			if basis == nil || idx >= uint64(count) {
+				return literal, fmt.Errorf("无效的块序号: %d", idx)
+			}
+			off := int64(idx) * int64(bs)
+			n := int64(bs)
+			if off+n > basisSize {
+				n = basisSize - off
+			}
+			if written+n > size {
+				return literal, fmt.Errorf("差异数据超出文件大小")
+			}
+			if _, err := io.Copy(w, io.NewSectionReader(basis, off, n)); err != nil {
+				return literal, fmt.Errorf("读取原文件失败: %v", err)
+			}
+			written += n
+			onChunk(n)
+		case deltaOpEnd:
+			var sum [sha256.Size]byte
+			if _, err := io.ReadFull(reader, sum[:]); err != nil {
+				return literal, fmt.Errorf("读取差异数据失败: %v", err)
+			}
+			if err := bw.Flush(); err != nil {
+				return literal, err
+			}
+			if written != size || !bytes.Equal(sum[:], hash.Sum(nil)) {
+				return literal, fmt.Errorf("差异传输校验失败")
+			}
+			return literal, nil
+		default:
+			return literal, fmt.Errorf("无效的差异操作: %q", op)
+		}
+	}
+}
+
+// receiveDelta 向发送端答复 basisPath 的块签名，然后按差异操作流把新文件写入 file，返回字面数据的字节数
+func (r *Receiver) receiveDelta(file *os.File, reader *bufio.Reader, conn net.Conn, basisPath string, size int64, onChunk func(int64)) (int64, error) {
+	basis, bs, count, basisSize, err := writeSignatures(conn, basisPath)
+	if err != nil {
+		return 0, fmt.Errorf("发送块签名失败: %v", err)
+	}
+	if basis != nil {
+		defer basis.Close()
+	}
+	return applyDelta(reader, r.sess.throttledReader(reader), file, basis, bs, count, basisSize, size, onChunk)
+}
+
+// --------------------------- 发送端 ---------------------------
+// readSignatures 读取接收端发来的块签名
+func readSignatures(reader *bufio.Reader) (bs int, sigs []blockSig, basisSize int64, err error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("读取块签名失败: %v", err)
+	}
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 || parts[0] != SignatureMarker {
+		return 0, nil, 0, fmt.Errorf("块签名格式错误")
+	}
+	bs, err1 := strconv.Atoi(parts[1])
+	count, err2 := strconv.Atoi(parts[2])
+	basisSize, err3 := strconv.ParseInt(parts[3], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || count < 0 {
+		return 0, nil, 0, fmt.Errorf("块签名格式错误")
+	}
+	if count == 0 {
+		return 0, nil, 0, nil
+	}
+	// 块数由对方给出，分配前限制上限，避免构造的答复耗尽内存
+	if count > deltaMaxBlocks || bs < deltaMinBlock || bs > deltaMaxBlock || int64(count) != (basisSize+int64(bs)-1)/int64(bs) {
+		return 0, nil, 0, fmt.Errorf("块签名格式错误")
+	}
+
+	sigs = make([]blockSig, count)
+	var raw [4 + deltaStrongLen]byte
+	for i := range sigs {
+		if _, err := io.ReadFull(reader, raw[:]); err != nil {
+			return 0, nil, 0, fmt.Errorf("读取块签名失败: %v", err)
+		}
+		sigs[i].weak = binary.BigEndian.Uint32(raw[:4])
+		copy(sigs[i].strong[:], raw[4:])
+	}
+	return bs, sigs, basisSize, nil
+}
+
+// sendDelta 在差异文件头之后读取接收端的块签名，只发送变化的部分
+func (s *Sender) sendDelta(conn net.Conn, f *os.File, rel string, fi os.FileInfo, startTime time.Time, transferredBytes *int64) error {
+	bs, sigs, basisSize, err := readSignatures(s.reader)
+	if err != nil {
+		return fmt.Errorf("%s: %v", rel, err)
+	}
+	w := bufio.NewWriterSize(s.sess.throttledWriter(conn), BufferSize)
+	literal, err := writeDelta(w, f, bs, sigs, basisSize, func(n int64) {
+		*transferredBytes += n
+		s.sess.progress(rel, *transferredBytes, startTime)
+	})
+	if err != nil {
+		return fmt.Errorf("发送文件内容失败 %s: %v", rel, err)
+	}
+
+	s.sess.update(func(st *Stats) {
+		st.CompletedFiles++
+		st.SavedBytes += fi.Size() - literal
+	})
+	s.sess.progress("", *transferredBytes, startTime)
+	return nil
+}
+
+// writeDelta 对照块签名发送 src 的差异操作，返回字面数据的字节数。onSource 按已处理的源文件字节数回调。
+func writeDelta(w *bufio.Writer, src io.Reader, bs int, sigs []blockSig, basisSize int64, onSource func(int64)) (int64, error) {
+	hash := sha256.New()
+	src = io.TeeReader(src, hash)
+	var literal int64
+
+	emitLiteral := func(p []byte) error {
+		for len(p) > 0 {
+			n := len(p)
+			if n > deltaMaxLiteral {
+				n = deltaMaxLiteral
+			}
+			w.WriteByte(deltaOpLiteral)
+			binary.Write(w, binary.BigEndian, uint32(n))
+			if _, err := w.Write(p[:n]); err != nil {
+				return fmt.Errorf("发送差异数据失败: %v", err)
+			}
+			literal += int64(n)
+			onSource(int64(n))
+			p = p[n:]
+		}
+		return nil
+	}
+	emitBlock := func(idx, n int) error {
+		w.WriteByte(deltaOpBlock)
+		if err := binary.Write(w, binary.BigEndian, uint64(idx)); err != nil {
+			return fmt.Errorf("发送差异数据失败: %v", err)
+		}
+		onSource(int64(n))
+		return nil
+	}
+
+	index := make(map[uint32][]int, len(sigs))
+	for i, s := range sigs {
+		index[s.weak] = append(index[s.weak], i)
+	}
+	lastLen := 0
+	if len(sigs) > 0 {
+		lastLen = int(basisSize - int64(len(sigs)-1)*int64(bs))
+	}
+	// match 返回与 p 相同的原文件块序号，没有时返回 -1
+	match := func(weak uint32, p []byte) int {
+		candidates, ok := index[weak]
+		if !ok {
+			return -1
+		}
+		strong := strongSum(p)
+		for _, i := range candidates {
+			blockLen := bs
+			if i == len(sigs)-1 {
+				blockLen = lastLen
+			}
+			if blockLen == len(p) && sigs[i].strong == strong {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// buf[lit:pos] 为尚未发送的字面数据，buf[pos:pos+bs] 为当前窗口，buf[:n] 为已读取的数据
+	buf := make([]byte, deltaMaxLiteral+4*bs)
+	n, lit, pos := 0, 0, 0
+	eof := len(sigs) == 0
+	fill := func() error {
+		if lit > 0 {
+			copy(buf, buf[lit:n])
+			n, pos, lit = n-lit, pos-lit, 0
+		}
+		for n < len(buf) && !eof {
+			m, err := src.Read(buf[n:])
+			n += m
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return fmt.Errorf("读取文件失败: %v", err)
+			}
+		}
+		return nil
+	}
+
+	if len(sigs) == 0 {
+		// 接收端没有可复用的文件，全部作为字面数据发送
+		for {
+			m, err := io.ReadFull(src, buf)
+			if m > 0 {
+				if err := emitLiteral(buf[:m]); err != nil {
+					return literal, err
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return literal, fmt.Errorf("读取文件失败: %v", err)
+			}
+		}
+	} else {
+		var a, b uint32
+		haveSum := false
+		for {
+			if pos+bs > n && !eof {
+				if err := fill(); err != nil {
+					return literal, err
+				}
+			}
+			if pos+bs > n {
+				break
+			}
+			if !haveSum {
+				a, b = weakSum(buf[pos : pos+bs])
+				haveSum = true
+			}
+			if i := match(a|b<<16, buf[pos:pos+bs]); i >= 0 {
+				if err := emitLiteral(buf[lit:pos]); err != nil {
+					return literal, err
+				}
+				if err := emitBlock(i, bs); err != nil {
+					return literal, err
+				}
+				pos += bs
+				lit = pos
+				haveSum = false
+				continue
+			}
+
+			// 窗口后移一个字节
+			if pos+bs == n {
+				if eof {
+					break
+				}
+				if err := fill(); err != nil {
+					return literal, err
+				}
+				if pos+bs == n {
+					break
+				}
+			}
+			out, in := uint32(buf[pos]), uint32(buf[pos+bs])
+			a = (a - out + in) & 0xffff
+			b = (b - uint32(bs)*out + a) & 0xffff
+			pos++
+			if pos-lit >= deltaMaxLiteral {
+				if err := emitLiteral(buf[lit:pos]); err != nil {
+					return literal, err
+				}
+				lit = pos
+			}
+		}
+
+		// 不足一块的结尾可与原文件的最后一块匹配
+		if tail := buf[pos:n]; len(tail) > 0 && len(tail) < bs {
+			ta, tb := weakSum(tail)
+			if i := match(ta|tb<<16, tail); i >= 0 {
+				if err := emitLiteral(buf[lit:pos]); err != nil {
+					return literal, err
+				}
+				if err := emitBlock(i, len(tail)); err != nil {
+					return literal, err
+				}
+				lit = n
+			}
+		}
+		if err := emitLiteral(buf[lit:n]); err != nil {
+			return literal, err
+		}
+	}
+
+	w.WriteByte(deltaOpEnd)
+	if _, err := w.Write(hash.Sum(nil)); err != nil {
+		return literal, fmt.Errorf("发送差异数据失败: %v", err)
+	}
+	return literal, w.Flush()
+}
@@ -0,0 +1,53 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSignaturesLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{"无可复用文件", "SIGS|0|0|0", false},
+		{"块数过多", fmt.Sprintf("SIGS|%d|%d|%d", deltaMaxBlock, deltaMaxBlocks+1, int64(deltaMaxBlocks+1)*deltaMaxBlock), true},
+		{"块数与大小不符", fmt.Sprintf("SIGS|%d|3|%d", deltaMinBlock, deltaMinBlock), true},
+		{"块大小过小", "SIGS|16|1|16", true},
+		{"块数为负", "SIGS|4096|-1|0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := readSignatures(bufio.NewReader(strings.NewReader(tt.line + "\n")))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v，期望出错 = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	old := strings.Repeat("0123456789abcdef", deltaMinSize/16*2)
+	changed := old[:len(old)/2] + "changed" + old[len(old)/2+7:]
+	writeTree(t, src, map[string]string{"big.bin": changed})
+	writeTree(t, dest, map[string]string{"big.bin": old})
+
+	s := &Sender{Delta: true}
+	sendErr, recvErr := sendLoopback(t, s, &Receiver{Dir: dest}, []string{filepath.Join(src, "big.bin")}, nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("发送: %v, 接收: %v", sendErr, recvErr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "big.bin")); string(got) != changed {
+		t.Error("重建的文件内容不符")
+	}
+	if saved := s.sess.snapshot().SavedBytes; saved <= 0 {
+		t.Errorf("SavedBytes = %d，应复用原文件的块", saved)
+	}
+}
@@ -0,0 +1,187 @@
+package transfer
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 网络工具方法 ---------------------------
+// LocalIP 返回本机用于局域网通信的 IPv4 地址
+func LocalIP() (string, error) {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		ifaces, _ := net.Interfaces()
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+				addrs, _ := iface.Addrs()
+				for _, addr := range addrs {
+					if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+						return ipNet.IP.String(), nil
+					}
+				}
+			}
+		}
+		return "", fmt.Errorf("无法获取本地IP")
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// ConnectAddr 返回本机的手动连接地址 主机:端口，供其他设备扫码或作为接收端地址输入
+func ConnectAddr(host string) string {
+	return net.JoinHostPort(host, strconv.Itoa(DefaultPort))
+}
+
+// receiverAddr 将接收端地址（主机或 主机:端口）转换为可拨号的 主机:端口，未指定端口时使用 DefaultPort
+func receiverAddr(target string) string {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(target, strconv.Itoa(DefaultPort))
+}
+
+// --------------------------- 自动发现 ---------------------------
+// Discoverer 通过 UDP 广播查找局域网内的接收端，并在接收端一侧应答查找请求。
+// 零值即可使用。
+type Discoverer struct{}
+
+// discoveryPortMu 由正在 DiscoveryResponsePort 上接收应答的查找持有。同时进行的其他查找
+// （如队列中多个未指定接收端的任务和界面上的查找）不等待它，改为在临时端口上接收应答
+var discoveryPortMu sync.Mutex
+
+// listen 在发现应答端口上监听，返回连接、发现请求报文、广播地址和用完后的释放函数。
+// 应答端口已被本进程的其他查找占用时改用临时端口，请求中携带实际监听的端口，接收端按其应答。
+func (d *Discoverer) listen() (*net.UDPConn, []byte, *net.UDPAddr, func(), error) {
+	localIP, err := LocalIP()
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("获取本地IP失败: %v", err)
+	}
+
+	port := DiscoveryResponsePort
+	held := discoveryPortMu.TryLock()
+	if !held {
+		port = 0
+	}
+	localAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(localIP, strconv.Itoa(port)))
+	if err != nil {
+		if held {
+			discoveryPortMu.Unlock()
+		}
+		return nil, nil, nil, nil, err
+	}
+	conn, err := net.ListenUDP("udp", localAddr)
+	if err != nil {
+		if held {
+			discoveryPortMu.Unlock()
+		}
+		return nil, nil, nil, nil, fmt.Errorf("监听 UDP 端口失败: %v", err)
+	}
+	release := func() {
+		conn.Close()
+		if held {
+			discoveryPortMu.Unlock()
+		}
+	}
+
+	broadcastAddr, _ := net.ResolveUDPAddr("udp", fmt.Sprintf("255.255.255.255:%d", DiscoveryPort))
+	req := []byte(fmt.Sprintf("%s|%s|%d", DiscoveryMessage, localIP, conn.LocalAddr().(*net.UDPAddr).Port))
+	return conn, req, broadcastAddr, release, nil
+}
+
+// FindFirst 广播发现请求并返回第一个应答的接收端地址，最多等待 TimeoutDuration。
+// 不等待同时进行的其他查找，见 listen。
+func (d *Discoverer) FindFirst() (string, error) {
+	conn, req, broadcastAddr, release, err := d.listen()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration))
+
+	for i := 0; i < 3; i++ {
+		conn.WriteToUDP(req, broadcastAddr)
+		time.Sleep(time.Second)
+	}
+
+	buf := make([]byte, 1024)
+	n, remoteAddr, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		return "", fmt.Errorf("未发现接收端或超时 (%v)", err)
+	}
+	if strings.TrimSpace(string(buf[:n])) == DiscoveryResponse {
+		return remoteAddr.IP.String(), nil
+	}
+	return "", fmt.Errorf("收到无效响应")
+}
+
+// FindAll 广播发现请求，在 timeout 内收集所有应答的接收端地址。
+// 不等待同时进行的其他查找（如队列任务中最长 TimeoutDuration 的 FindFirst），见 listen。
+func (d *Discoverer) FindAll(timeout time.Duration) ([]string, error) {
+	conn, req, broadcastAddr, release, err := d.listen()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	conn.WriteToUDP(req, broadcastAddr)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var peers []string
+	seen := make(map[string]bool)
+	buf := make([]byte, 1024)
+	for {
+		n, remoteAddr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// 读取超时即收集结束
+			break
+		}
+		ip := remoteAddr.IP.String()
+		if strings.TrimSpace(string(buf[:n])) == DiscoveryResponse && !seen[ip] {
+			seen[ip] = true
+			peers = append(peers, ip)
+		}
+	}
+	return peers, nil
+}
+
+// Serve 应答发现请求，直到 quit 关闭
+func (d *Discoverer) Serve(quit <-chan struct{}) {
+	localIP, err := LocalIP()
+	if err != nil {
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", localIP, DiscoveryPort))
+	if err != nil {
+		return
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+			conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				continue
+			}
+			parts := strings.Split(strings.TrimSpace(string(buf[:n])), "|")
+			if len(parts) == 3 && parts[0] == DiscoveryMessage {
+				senderIP := parts[1]
+				senderPort, _ := strconv.Atoi(parts[2])
+				respAddr, _ := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", senderIP, senderPort))
+				conn.WriteToUDP([]byte(DiscoveryResponse), respAddr)
+			}
+		}
+	}
+}
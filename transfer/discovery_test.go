@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 同时进行的查找互不等待，也不因应答端口被占用而失败
+func TestConcurrentDiscovery(t *testing.T) {
+	if _, err := LocalIP(); err != nil {
+		t.Skipf("无可用的局域网地址: %v", err)
+	}
+	const timeout = 300 * time.Millisecond
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	start := time.Now()
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = (&Discoverer{}).FindAll(timeout)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 2*timeout {
+		t.Errorf("耗时 %v，查找被依次执行", elapsed)
+	}
+}
+
+// 应答端口被占用时改用临时端口，请求中携带实际监听的端口
+func TestDiscoveryListenPort(t *testing.T) {
+	if _, err := LocalIP(); err != nil {
+		t.Skipf("无可用的局域网地址: %v", err)
+	}
+	var d Discoverer
+	first, firstReq, _, releaseFirst, err := d.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseFirst()
+	second, secondReq, _, releaseSecond, err := d.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseSecond()
+
+	for _, tt := range []struct {
+		conn *net.UDPConn
+		req  []byte
+	}{{first, firstReq}, {second, secondReq}} {
+		port := strconv.Itoa(tt.conn.LocalAddr().(*net.UDPAddr).Port)
+		if !strings.HasSuffix(string(tt.req), "|"+port) {
+			t.Errorf("请求 %q 未携带监听端口 %s", tt.req, port)
+		}
+	}
+	if port := first.LocalAddr().(*net.UDPAddr).Port; port != DiscoveryResponsePort {
+		t.Errorf("第一个查找监听端口 %d，应为 %d", port, DiscoveryResponsePort)
+	}
+	if second.LocalAddr().(*net.UDPAddr).Port == DiscoveryResponsePort {
+		t.Error("第二个查找应改用临时端口")
+	}
+}
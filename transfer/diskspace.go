@@ -0,0 +1,89 @@
+package transfer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 磁盘空间检查 ---------------------------
+const (
+	AcceptMarker     = "ACCEPT" // 接收端同意传输
+	RejectMarker     = "REJECT" // 接收端拒绝传输: REJECT|原因
+	HandshakeTimeout = 5 * time.Second
+	maxRawLine       = 64 * 1024 // readRawLine 允许的最大行长度
+	legacyRecheck    = 10 * time.Minute
+)
+
+// legacyReceivers 记录握手超时的接收端地址及其记录时间，
+// 在 legacyRecheck 内再次发送到这些地址时不再等待答复，避免每次（包括分发的每个目标）都等满超时
+var legacyReceivers sync.Map
+
+// checkDiskSpace 检查 dir 所在文件系统能否容纳 totalBytes。
+// 空间不足时返回拒绝原因；剩余空间将低于 margin 时返回警告。
+func checkDiskSpace(dir string, totalBytes, margin int64) (reject string, warning string) {
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		// 无法获取可用空间时不阻止传输
+		return "", ""
+	}
+	if totalBytes > free {
+		return fmt.Sprintf("磁盘空间不足: 需要 %s，可用 %s", FormatFileSize(totalBytes), FormatFileSize(free)), ""
+	}
+	if margin > 0 && free-totalBytes < margin {
+		return "", fmt.Sprintf("传输完成后剩余空间仅 %s，低于设定的 %s", FormatFileSize(free-totalBytes), FormatFileSize(margin))
+	}
+	return "", ""
+}
+
+// waitForAccept 读取接收端对统计信息的答复，返回拒绝原因以及接收端支持的扩展（如 DELTA、DEDUP）。
+// 旧版接收端不会答复，超时后视为同意以保持兼容，并在一段时间内跳过对该地址的等待。
+func waitForAccept(conn net.Conn) (reject string, caps []string) {
+	addr := conn.RemoteAddr().String()
+	if at, ok := legacyReceivers.Load(addr); ok && time.Since(at.(time.Time)) < legacyRecheck {
+		return "", nil
+	}
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	text, err := readRawLine(conn)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			legacyReceivers.Store(addr, time.Now())
+		}
+		return "", nil
+	}
+	legacyReceivers.Delete(addr)
+	parts := strings.SplitN(text, "|", 2)
+	if parts[0] == RejectMarker {
+		if len(parts) == 2 {
+			return parts[1], nil
+		}
+		return "未知原因", nil
+	}
+	return "", strings.Split(text, "|")[1:]
+}
+
+// readRawLine 逐字节读取一行并去掉首尾空白，避免缓冲读取吞掉之后的数据
+func readRawLine(conn net.Conn) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			continue
+		}
+		if buf[0] == '\n' {
+			return strings.TrimSpace(string(line)), nil
+		}
+		if len(line) >= maxRawLine {
+			return "", fmt.Errorf("答复过长")
+		}
+		line = append(line, buf[0])
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package transfer
+
+import "fmt"
+
+// freeDiskSpace 在不支持的平台上返回错误，此时跳过空间检查
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, fmt.Errorf("不支持获取可用空间")
+}
@@ -0,0 +1,98 @@
+package transfer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFormatStats(t *testing.T) {
+	if got := formatStats(2, 100, 100); got != StatsMarker+"|2|100\n" {
+		t.Errorf("无稀疏文件: %q", got)
+	}
+	if got := formatStats(2, 100, 40); got != StatsMarker+"|2|100|40\n" {
+		t.Errorf("含稀疏文件: %q", got)
+	}
+}
+
+func TestDiskUsageSparse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 << 20
+	if _, err := f.Write(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mayBeSparse(info) {
+		t.Skip("平台或文件系统不支持稀疏文件")
+	}
+	if got := diskUsage(path, info); got >= size/2 {
+		t.Errorf("稀疏文件的磁盘占用 = %d，应只计数据段", got)
+	}
+
+	_, bytes, disk, err := scanFiles(filepath.Dir(path), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes != size || disk >= bytes {
+		t.Errorf("扫描结果: 字节数 %d，磁盘占用 %d", bytes, disk)
+	}
+}
+
+func TestWaitForAcceptLegacy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte(AcceptMarker + "|" + DeltaCapability + "\n"))
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	addr := conn.RemoteAddr().String()
+	defer legacyReceivers.Delete(addr)
+
+	// 已记录为旧版的接收端不再等待答复
+	legacyReceivers.Store(addr, time.Now())
+	start := time.Now()
+	if reject, caps := waitForAccept(conn); reject != "" || caps != nil {
+		t.Errorf("旧版接收端: reject=%q caps=%v", reject, caps)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("等待了 %v", elapsed)
+	}
+
+	// 记录过期后重新等待答复，收到答复后不再视为旧版
+	legacyReceivers.Store(addr, time.Now().Add(-legacyRecheck))
+	if _, caps := waitForAccept(conn); len(caps) != 1 || caps[0] != DeltaCapability {
+		t.Errorf("caps = %v", caps)
+	}
+	if _, ok := legacyReceivers.Load(addr); ok {
+		t.Error("答复后仍记录为旧版接收端")
+	}
+}
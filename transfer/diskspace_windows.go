@@ -0,0 +1,18 @@
+//go:build windows
+
+package transfer
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace 返回 dir 所在卷对当前用户可用的字节数
+func freeDiskSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
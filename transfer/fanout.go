@@ -0,0 +1,481 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// --------------------------- 一对多发送 ---------------------------
+// SendToMany 对每个接收端分别建立连接并握手，之后只遍历和读取一次文件，把条目头和文件内容
+// 放入各接收端的发送队列，由各自的 goroutine 写出。队列中的文件内容最多约 FanOutBuffer 字节，
+// 条目头和文件结束标记不计入，只受 fanOutQueueItems 项的总数限制：较慢的接收端最多落后这么多；
+// 队列满而其他接收端已把队列发空时，它已拖慢其他接收端，立即放弃。
+// 所有接收端都较慢时读取一起等待，持续超过 fanOutStallTimeout 仍满或写入失败的接收端被放弃，
+// 其余接收端继续。各接收端使用普通的逐文件协议，不使用差异传输、去重和归档。
+const (
+	DefaultFanOutBuffer = 64 * 1024 * 1024      // 每个接收端默认可落后的字节数
+	fanOutChunkSize     = 256 * 1024            // 读取文件内容的块大小
+	fanOutQueueItems    = 1 << 14               // 每个接收端队列最多的项数，限制条目头占用的内存
+	fanOutStallTimeout  = 10 * time.Second      // 队列持续满的最长时间，须明显短于接收端 30 秒的读取超时，以免其他接收端因空等而超时
+	fanOutPollInterval  = 20 * time.Millisecond // 等待队列满的接收端时检查其他接收端是否已空闲的间隔
+)
+
+// TargetObserver 接收一对多发送中各接收端的状态和统计信息，target 为接收端地址。
+// 回调可能在不同接收端的 goroutine 中并发执行，实现需自行同步且不应阻塞。
+type TargetObserver interface {
+	TargetStatusChanged(target, status string)
+	TargetStatsUpdated(target string, stats Stats)
+}
+
+// TargetResult 为一对多发送中一个接收端的结果
+type TargetResult struct {
+	Target string `json:"target"`
+	Error  string `json:"error"` // 为空表示发送成功
+	Stats  Stats  `json:"stats"`
+}
+
+// targetObserver 将单个接收端会话的回调转发给 TargetObserver
+type targetObserver struct {
+	target string
+	o      TargetObserver
+}
+
+func (t targetObserver) StatusChanged(status string) { t.o.TargetStatusChanged(t.target, status) }
+func (t targetObserver) StatsUpdated(stats Stats)    { t.o.TargetStatsUpdated(t.target, stats) }
+
+// fanOutChunk 为发送队列中的一项：条目头、文件内容或文件结束
+type fanOutChunk struct {
+	data     []byte // 原样写出的字节，各接收端共享，不得修改
+	rel      string
+	payload  bool  // data 是否为文件内容，计入进度
+	fileDone bool  // 文件结束，holes 为稀疏文件中不传输的空洞字节数
+	holes    int64 // 空洞不占传输量，但计入进度
+}
+
+// fanOutTarget 为一个接收端的连接、会话和发送队列
+type fanOutTarget struct {
+	addr    string
+	conn    net.Conn
+	sess    *session
+	queue   chan fanOutChunk
+	budget  int64         // 队列中允许的文件内容字节数
+	sent    chan struct{} // 写出一项后发出信号，唤醒等待空位的读取端
+	dead    chan struct{} // 放弃该接收端时关闭，读取端不再向其排队
+	once    sync.Once
+	err     error
+	mu      sync.Mutex
+	pending int64 // 队列中尚未写出的文件内容字节数
+}
+
+// tryPut 在不超过字节预算和项数上限时将 c 放入队列。队列中没有文件内容时总能放入一块，
+// 以免预算小于一块时永远放不进。只由读取端调用。
+func (t *fanOutTarget) tryPut(c fanOutChunk) bool {
+	var size int64
+	if c.payload {
+		size = int64(len(c.data))
+		t.mu.Lock()
+		if t.pending > 0 && t.pending+size > t.budget {
+			t.mu.Unlock()
+			return false
+		}
+		t.pending += size
+		t.mu.Unlock()
+	}
+	select {
+	case t.queue <- c:
+		return true
+	default:
+		t.release(size)
+		return false
+	}
+}
+
+// release 归还已写出或未能放入队列的文件内容字节数
+func (t *fanOutTarget) release(size int64) {
+	if size == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.pending -= size
+	t.mu.Unlock()
+}
+
+// fail 放弃该接收端并关闭连接，只有第一次调用生效
+func (t *fanOutTarget) fail(err error) {
+	t.once.Do(func() {
+		t.err = err
+		if t.conn != nil {
+			t.conn.Close()
+		}
+		close(t.dead)
+	})
+}
+
+func (t *fanOutTarget) failed() bool {
+	select {
+	case <-t.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+// SendToMany 将 paths 同时发送到 targets 中的每个接收端，每个文件只读取一次。
+// Observer 收到按读取进度汇总的统计，TargetObserver 收到各接收端各自的进度。
+// 部分接收端失败时仍返回 nil，各自的错误记录在结果中；所有接收端都失败时返回错误。
+func (s *Sender) SendToMany(paths, targets []string) (results []TargetResult, err error) {
+	s.sess = newSession(s.Observer, s.Limiters)
+	defer func() {
+		if err != nil && s.isCanceled() {
+			err = ErrCanceled
+		}
+		if err != nil {
+			s.sess.fail(err)
+		}
+	}()
+
+	// 去掉空地址和重复的地址，保持原有顺序
+	var unique []string
+	for _, t := range targets {
+		if t != "" && !slices.Contains(unique, t) {
+			unique = append(unique, t)
+		}
+	}
+	targets = unique
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("未指定接收端")
+	}
+	roots, err := buildSendRoots(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sess.status("正在扫描文件...")
+	s.sess.update(func(st *Stats) { st.Status = "scanning" })
+	var totalFiles int
+	var totalBytes, diskBytes int64
+	for _, root := range roots {
+		files, bytes, disk, err := scanFiles(root.Path, s.Filter, true)
+		if err != nil {
+			return nil, fmt.Errorf("扫描文件失败: %v", err)
+		}
+		totalFiles += files
+		totalBytes += bytes
+		diskBytes += disk
+	}
+	s.sess.update(func(st *Stats) {
+		st.TotalFiles = totalFiles
+		st.TotalBytes = totalBytes
+		st.Status = "transferring"
+	})
+
+	// 并发连接所有接收端，连接或握手失败的接收端直接记为失败
+	buffer := s.FanOutBuffer
+	if buffer <= 0 {
+		buffer = DefaultFanOutBuffer
+	}
+	var observer TargetObserver = nopTargetObserver{}
+	if s.TargetObserver != nil {
+		observer = s.TargetObserver
+	}
+	ts := make([]*fanOutTarget, len(targets))
+	var wg sync.WaitGroup
+	for i, addr := range targets {
+		t := &fanOutTarget{
+			addr:   addr,
+			sess:   newSession(targetObserver{target: addr, o: observer}, s.Limiters),
+			queue:  make(chan fanOutChunk, fanOutQueueItems),
+			budget: buffer,
+			sent:   make(chan struct{}, 1),
+			dead:   make(chan struct{}),
+		}
+		ts[i] = t
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.fanOutHandshake(t, roots, totalFiles, totalBytes, diskBytes); err != nil {
+				t.fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 各接收端的写出 goroutine
+	for _, t := range ts {
+		if t.failed() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runFanOutTarget(t)
+		}()
+	}
+
+	if live := countLive(ts); live > 0 {
+		s.sess.status(fmt.Sprintf("正在发送到 %d 个接收端...", live))
+	}
+	err = s.produceFanOut(ts, roots)
+	if err != nil {
+		// 读取失败时各接收端收到的流已不完整，全部中止
+		for _, t := range ts {
+			t.fail(err)
+		}
+	}
+	for _, t := range ts {
+		close(t.queue)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, t := range ts {
+		res := TargetResult{Target: t.addr, Stats: t.sess.snapshot()}
+		if t.err != nil {
+			res.Error = t.err.Error()
+			t.sess.fail(t.err)
+		} else {
+			succeeded++
+		}
+		results = append(results, res)
+	}
+	if err != nil {
+		return results, err
+	}
+	if succeeded == 0 {
+		return results, fmt.Errorf("所有接收端均发送失败")
+	}
+
+	s.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+		st.CompletedFiles = st.TotalFiles
+		st.TransferredBytes = st.TotalBytes
+	})
+	s.sess.status(fmt.Sprintf("已发送到 %d/%d 个接收端", succeeded, len(ts)))
+	return results, nil
+}
+
+type nopTargetObserver struct{}
+
+func (nopTargetObserver) TargetStatusChanged(string, string) {}
+func (nopTargetObserver) TargetStatsUpdated(string, Stats)   {}
+
+func countLive(ts []*fanOutTarget) int {
+	n := 0
+	for _, t := range ts {
+		if !t.failed() {
+			n++
+		}
+	}
+	return n
+}
+
+// fanOutHandshake 连接一个接收端并发送清单和统计信息，等待其同意
+func (s *Sender) fanOutHandshake(t *fanOutTarget, roots []sendRoot, totalFiles int, totalBytes, diskBytes int64) error {
+	t.sess.update(func(st *Stats) {
+		st.TotalFiles = totalFiles
+		st.TotalBytes = totalBytes
+		st.Status = "transferring"
+	})
+	conn, err := dialReceiver(t.addr)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	if err := s.attach(conn); err != nil {
+		return err
+	}
+	if err := writeManifest(conn, roots); err != nil {
+		return fmt.Errorf("发送元数据失败: %v", err)
+	}
+	if _, err := io.WriteString(conn, formatStats(totalFiles, totalBytes, diskBytes)); err != nil {
+		return fmt.Errorf("发送统计信息失败: %v", err)
+	}
+	if reason, _ := waitForAccept(conn); reason != "" {
+		return fmt.Errorf("接收端拒绝传输: %s", reason)
+	}
+	t.sess.status("已连接到接收端: " + t.addr)
+	return nil
+}
+
+// runFanOutTarget 将队列中的数据依次写到接收端，直到队列关闭或写入失败
+func (s *Sender) runFanOutTarget(t *fanOutTarget) {
+	w := t.sess.throttledWriter(t.conn)
+	startTime := time.Now()
+	var sent int64
+	for c := range t.queue {
+		if t.failed() {
+			return
+		}
+		if len(c.data) > 0 {
+			t.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+			if _, err := w.Write(c.data); err != nil {
+				t.fail(fmt.Errorf("发送失败 %s: %v", c.rel, err))
+				return
+			}
+		}
+		if c.payload {
+			t.release(int64(len(c.data)))
+			sent += int64(len(c.data))
+			t.sess.progress(c.rel, sent, startTime)
+		}
+		select {
+		case t.sent <- struct{}{}:
+		default:
+		}
+		if c.fileDone {
+			sent += c.holes
+			t.sess.mu.Lock()
+			t.sess.stats.CompletedFiles++
+			t.sess.mu.Unlock()
+			t.sess.progress("", sent, startTime)
+		}
+	}
+	if t.failed() {
+		return
+	}
+	t.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+		st.CompletedFiles = st.TotalFiles
+		st.TransferredBytes = st.TotalBytes
+	})
+	t.sess.status("发送完成")
+}
+
+// broadcast 将一项放入所有未放弃的接收端的队列，队列满的接收端由 waitQueue 等待或放弃。
+// 所有接收端都已放弃时返回错误，停止读取。
+func (s *Sender) broadcast(ts []*fanOutTarget, c fanOutChunk) error {
+	var full []*fanOutTarget
+	for _, t := range ts {
+		if !t.failed() && !t.tryPut(c) {
+			full = append(full, t)
+		}
+	}
+	// 各接收端共用同一个截止时间，总的等待不超过 fanOutStallTimeout
+	deadline := time.Now().Add(fanOutStallTimeout)
+	for _, t := range full {
+		waitQueue(t, c, ts, deadline)
+	}
+	if countLive(ts) == 0 {
+		return fmt.Errorf("所有接收端均发送失败")
+	}
+	return nil
+}
+
+// waitQueue 等待 t 的队列腾出空位后放入 c。其他接收端的队列已发空时 t 已落后整个缓冲区，
+// 继续等待会拖慢它们，立即放弃 t；到 deadline 仍满时同样放弃。
+func waitQueue(t *fanOutTarget, c fanOutChunk, ts []*fanOutTarget, deadline time.Time) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	ticker := time.NewTicker(fanOutPollInterval)
+	defer ticker.Stop()
+	for {
+		if t.tryPut(c) {
+			return
+		}
+		select {
+		case <-t.sent:
+		case <-t.dead:
+			return
+		case <-timer.C:
+			t.fail(fmt.Errorf("接收端过慢，已放弃"))
+			return
+		case <-ticker.C:
+			if othersIdle(t, ts) {
+				t.fail(fmt.Errorf("接收端落后超过缓冲区，已放弃"))
+				return
+			}
+		}
+	}
+}
+
+// othersIdle 报告除 t 之外是否有未放弃的接收端已发完队列中的数据、正在等待读取
+func othersIdle(t *fanOutTarget, ts []*fanOutTarget) bool {
+	for _, u := range ts {
+		if u != t && !u.failed() && len(u.queue) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// produceFanOut 按过滤规则遍历各根，读取一次文件并广播条目头和内容
+func (s *Sender) produceFanOut(ts []*fanOutTarget, roots []sendRoot) error {
+	if countLive(ts) == 0 {
+		return fmt.Errorf("所有接收端均无法连接")
+	}
+	startTime := time.Now()
+	var readBytes int64
+
+	for _, root := range roots {
+		err := s.Filter.walkWarn(root.Path, root.Name, s.sess.warn, func(fullPath, rel string, info os.FileInfo) error {
+			if info.IsDir() {
+				return s.broadcast(ts, fanOutChunk{data: []byte(formatDirHeader(rel, info)), rel: rel})
+			}
+			if isSymlink(info) {
+				target, err := os.Readlink(fullPath)
+				if err != nil {
+					return fmt.Errorf("读取符号链接失败 %s: %v", fullPath, err)
+				}
+				return s.broadcast(ts, fanOutChunk{data: []byte(formatLinkHeader(rel, target)), rel: rel})
+			}
+			return s.broadcastFile(ts, fullPath, rel, info, startTime, &readBytes)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.broadcast(ts, fanOutChunk{data: []byte(EndMarker + "\n")})
+}
+
+// broadcastFile 读取一个文件并按块广播，稀疏文件只读取数据段
+func (s *Sender) broadcastFile(ts []*fanOutTarget, fullPath, rel string, info os.FileInfo, startTime time.Time, readBytes *int64) error {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Errorf("打开文件失败 %s: %v", fullPath, err)
+	}
+	defer f.Close()
+
+	extents := sparseExtents(f, info.Size())
+	hdr := formatFileHeader(rel, info)
+	if extents != nil {
+		hdr = formatSparseHeader(rel, info, extents)
+	} else {
+		extents = []extent{{Offset: 0, Length: info.Size()}}
+	}
+	if err := s.broadcast(ts, fanOutChunk{data: []byte(hdr), rel: rel}); err != nil {
+		return err
+	}
+
+	var dataBytes int64
+	for _, e := range extents {
+		if _, err := f.Seek(e.Offset, io.SeekStart); err != nil {
+			return fmt.Errorf("读取文件失败 %s: %v", rel, err)
+		}
+		for left := e.Length; left > 0; {
+			// 每块新分配缓冲区，各接收端的队列共享同一块数据
+			buf := make([]byte, min(left, fanOutChunkSize))
+			if _, err := io.ReadFull(f, buf); err != nil {
+				return fmt.Errorf("读取文件失败 %s: %v", rel, err)
+			}
+			if err := s.broadcast(ts, fanOutChunk{data: buf, rel: rel, payload: true}); err != nil {
+				return err
+			}
+			left -= int64(len(buf))
+			*readBytes += int64(len(buf))
+			s.sess.progress(rel, *readBytes, startTime)
+		}
+		dataBytes += e.Length
+	}
+	*readBytes += info.Size() - dataBytes
+	s.sess.mu.Lock()
+	s.sess.stats.CompletedFiles++
+	s.sess.mu.Unlock()
+	return s.broadcast(ts, fanOutChunk{rel: rel, fileDone: true, holes: info.Size() - dataBytes})
+}
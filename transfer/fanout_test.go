@@ -0,0 +1,192 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveOnce 由 r 在回环地址上接收一次会话，返回地址和接收端的错误
+func serveOnce(t *testing.T, r *Receiver) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		r.sess = newSession(r.Observer, r.Limiters)
+		done <- r.serve(conn, r.Dir)
+	}()
+	return ln.Addr().String(), done
+}
+
+// stalledReceiver 完成握手后不再读取，模拟卡住的接收端
+func stalledReceiver(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quit := make(chan struct{})
+	t.Cleanup(func() {
+		close(quit)
+		ln.Close()
+	})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, StatsMarker+"|") {
+				break
+			}
+		}
+		conn.Write([]byte(AcceptMarker + "\n"))
+		<-quit
+	}()
+	return ln.Addr().String()
+}
+
+// 卡住的接收端落后超过缓冲区后应立即放弃，不能让其他接收端等到超时
+func TestFanOutDropsStalledTarget(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "big.bin")
+	data := make([]byte, 48<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	fast, fastDone := serveOnce(t, &Receiver{Dir: dest})
+	slow := stalledReceiver(t)
+
+	start := time.Now()
+	s := &Sender{FanOutBuffer: 1 << 20}
+	results, err := s.SendToMany([]string{src}, []string{fast, slow})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-fastDone; err != nil {
+		t.Fatalf("正常的接收端: %v", err)
+	}
+	if elapsed >= fanOutStallTimeout {
+		t.Errorf("耗时 %v，正常的接收端被卡住的接收端拖到了超时", elapsed)
+	}
+
+	if len(results) != 2 || results[0].Error != "" || results[1].Error == "" {
+		t.Fatalf("results = %+v", results)
+	}
+	if !strings.Contains(results[1].Error, "落后") {
+		t.Errorf("卡住的接收端: %s", results[1].Error)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "big.bin"))
+	if err != nil || len(got) != len(data) {
+		t.Fatalf("正常的接收端收到 %d 字节: %v", len(got), err)
+	}
+}
+
+// drainReceiver 完成握手后等到 resume 关闭才开始读取（resume 为 nil 时立即读取），读到结束标记时把收到的数据发到返回的通道。
+// 数据只在内存中累积，不写入磁盘。
+func drainReceiver(t *testing.T, resume <-chan struct{}) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan []byte, 1)
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, StatsMarker+"|") {
+				break
+			}
+		}
+		conn.Write([]byte(AcceptMarker + "\n"))
+		if resume != nil {
+			<-resume
+		}
+		var got []byte
+		buf := make([]byte, 64*1024)
+		for !bytes.HasSuffix(got, []byte(EndMarker+"\n")) {
+			n, err := reader.Read(buf)
+			got = append(got, buf[:n]...)
+			if err != nil {
+				return
+			}
+		}
+		done <- got
+	}()
+	return ln.Addr().String(), done
+}
+
+// 许多小文件时队列中的项数远多于按块计算的数量，但落后的字节数仍在缓冲区内，
+// 较慢的接收端不应被放弃
+func TestFanOutKeepsTargetBehindOnManySmallFiles(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "many")
+	files := make(map[string]string)
+	for i := range 2000 {
+		files[fmt.Sprintf("d%02d/f%04d.txt", i%20, i)] = strings.Repeat(strconv.Itoa(i%10), 16*1024)
+	}
+	writeTree(t, src, files)
+
+	resume := make(chan struct{})
+	fast, fastDone := drainReceiver(t, nil)
+	slow, slowDone := drainReceiver(t, resume)
+	// 较快的接收端收完全部数据后，较慢的接收端才开始读取
+	var fastGot []byte
+	fastFinished := make(chan struct{})
+	go func() {
+		fastGot = <-fastDone
+		close(fastFinished)
+		close(resume)
+	}()
+
+	results, err := (&Sender{}).SendToMany([]string{src}, []string{fast, slow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Error != "" || results[1].Error != "" {
+		t.Fatalf("results = %+v", results)
+	}
+	<-fastFinished
+	slowGot := <-slowDone
+	if len(fastGot) == 0 || !bytes.Equal(fastGot, slowGot) {
+		t.Errorf("较快的接收端收到 %d 字节，较慢的接收端收到 %d 字节", len(fastGot), len(slowGot))
+	}
+}
@@ -0,0 +1,358 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// --------------------------- 过滤配置 ---------------------------
+const IgnoreFileName = ".gitignore"
+
+// filterPresets 内置的排除预设
+var filterPresets = map[string][]string{
+	"vcs":     {".git/", ".svn/", ".hg/"},
+	"node":    {"node_modules/"},
+	"build":   {"build/", "dist/", "target/", "out/", "bin/", "obj/", "__pycache__/", "*.pyc", "*.o"},
+	"os-junk": {".DS_Store", "Thumbs.db", "desktop.ini", "._*"},
+}
+
+// FilterPresets 返回内置的过滤预设
+func FilterPresets() map[string][]string {
+	return filterPresets
+}
+
+// SendOptions 发送选项
+type SendOptions struct {
+	Include        []string `json:"include"`        // 包含模式，为空表示包含全部文件
+	Exclude        []string `json:"exclude"`        // 排除模式
+	Presets        []string `json:"presets"`        // 内置排除预设: vcs, node, build, os-junk
+	UseIgnoreFiles bool     `json:"useIgnoreFiles"` // 是否遵循目录树中的 .gitignore
+	SymlinkPolicy  string   `json:"symlinkPolicy"`  // 符号链接策略: follow(默认), skip, link
+	Delta          bool     `json:"delta"`          // 对接收端已有的同名文件只发送差异
+	Dedup          bool     `json:"dedup"`          // 内容重复的文件只发送一次
+	Archive        string   `json:"archive"`        // 打包为归档流发送: tar, tar.gz, zip，为空时逐个发送
+}
+
+// --------------------------- 匹配规则 ---------------------------
+// ignoreRule 为一条 gitignore 风格的规则
+type ignoreRule struct {
+	pattern  string // 去掉前后修饰后的模式
+	base     string // 规则所在目录（相对发送根目录）
+	negate   bool   // 以 ! 开头
+	dirOnly  bool   // 以 / 结尾，只匹配目录
+	anchored bool   // 含 /，相对 base 匹配；否则只匹配文件名
+}
+
+func parseRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	r := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
+
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, r.base+"/")
+	}
+	return matchGlob(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchGlob 按路径段匹配，"**" 匹配零个或多个路径段
+func matchGlob(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchGlob(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// --------------------------- 文件过滤器 ---------------------------
+// Filter 为发送端的文件过滤器，nil 表示不过滤且跟随符号链接
+type Filter struct {
+	include        []ignoreRule
+	exclude        []ignoreRule
+	useIgnoreFiles bool
+	symlinks       string
+	only           map[string]bool // 非空时只包含这些文件（相对发送根目录的斜杠路径）
+}
+
+// NewFilter 根据发送选项创建过滤器，未设置任何过滤条件且跟随符号链接时返回 nil
+func NewFilter(opts SendOptions) (*Filter, error) {
+	if !validSymlinkPolicy(opts.SymlinkPolicy) {
+		return nil, fmt.Errorf("未知的符号链接策略: %s", opts.SymlinkPolicy)
+	}
+	f := &Filter{useIgnoreFiles: opts.UseIgnoreFiles, symlinks: opts.SymlinkPolicy}
+
+	patterns := append([]string{}, opts.Exclude...)
+	for _, name := range opts.Presets {
+		preset, ok := filterPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的过滤预设: %s", name)
+		}
+		patterns = append(patterns, preset...)
+	}
+
+	for _, p := range patterns {
+		if err := validatePattern(p); err != nil {
+			return nil, err
+		}
+		if r, ok := parseRule(p, ""); ok {
+			f.exclude = append(f.exclude, r)
+		}
+	}
+	for _, p := range opts.Include {
+		if err := validatePattern(p); err != nil {
+			return nil, err
+		}
+		if r, ok := parseRule(p, ""); ok {
+			f.include = append(f.include, r)
+		}
+	}
+
+	if len(f.include) == 0 && len(f.exclude) == 0 && !f.useIgnoreFiles && f.symlinkPolicy() == SymlinkFollow {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func validatePattern(p string) error {
+	for _, seg := range strings.Split(strings.Trim(strings.TrimPrefix(p, "!"), "/"), "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("无效的过滤模式 %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// loadIgnoreRules 读取 dir 下的 .gitignore 并追加到继承的规则之后
+func (f *Filter) loadIgnoreRules(dir, base string, inherited []ignoreRule) []ignoreRule {
+	if f == nil || !f.useIgnoreFiles {
+		return inherited
+	}
+	file, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return inherited
+	}
+	defer file.Close()
+
+	rules := append([]ignoreRule{}, inherited...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if r, ok := parseRule(scanner.Text(), base); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// excluded 判断 rel（相对发送根目录）是否被排除，后出现的规则优先
+func (f *Filter) excluded(rel string, isDir bool, rules []ignoreRule) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.exclude {
+		if r.matches(rel, isDir) {
+			return true
+		}
+	}
+	ignored := false
+	for _, r := range rules {
+		if r.matches(rel, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// restrictTo 返回只包含 rels 中文件的过滤器副本，其余规则不变
+func (f *Filter) restrictTo(rels []string) *Filter {
+	restricted := &Filter{}
+	if f != nil {
+		*restricted = *f
+	}
+	restricted.only = make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		restricted.only[rel] = true
+	}
+	return restricted
+}
+
+// included 判断文件是否满足包含模式
+func (f *Filter) included(rel string) bool {
+	if f != nil && f.only != nil && !f.only[rel] {
+		return false
+	}
+	if f == nil || len(f.include) == 0 {
+		return true
+	}
+	for _, r := range f.include {
+		if r.matches(rel, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) walksDirs() bool {
+	return f == nil || (len(f.include) == 0 && f.only == nil)
+}
+
+func (f *Filter) symlinkPolicy() string {
+	if f == nil || f.symlinks == "" {
+		return SymlinkFollow
+	}
+	return f.symlinks
+}
+
+// --------------------------- 过滤遍历 ---------------------------
+// walkFunc 的 rel 为发送到接收端的斜杠路径（文件夹时包含根目录名）
+type walkFunc func(fullPath, rel string, info os.FileInfo) error
+
+// walk 按字典序遍历 root 下未被过滤的文件和目录，目录先于其内容回调。
+// name 为根在接收端的名称，为空时使用原名。root 为单个文件时不应用过滤规则。
+// 设置了包含模式时只回调文件，避免在接收端产生大量空目录。
+// 符号链接策略为 link 时，链接以 Lstat 信息回调；跟随链接时跳过指向祖先目录的循环。
+func (f *Filter) walk(root, name string, fn walkFunc) error {
+	return f.walkWarn(root, name, nil, fn)
+}
+
+// walkWarn 与 walk 相同，跳过失效或循环的符号链接时通过 warn 报告（warn 可为 nil）
+func (f *Filter) walkWarn(root, name string, warn func(msg string), fn walkFunc) error {
+	if warn == nil {
+		warn = func(string) {}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("获取文件信息失败 %s: %v", root, err)
+	}
+	if name == "" {
+		name = info.Name()
+	}
+	if !info.IsDir() {
+		return fn(root, name, info)
+	}
+	if f.walksDirs() {
+		if err := fn(root, name, info); err != nil {
+			return err
+		}
+	}
+	return f.walkDir(root, name, "", nil, []os.FileInfo{info}, warn, fn)
+}
+
+func (f *Filter) walkDir(dir, rel, match string, rules []ignoreRule, ancestors []os.FileInfo, warn func(string), fn walkFunc) error {
+	rules = f.loadIgnoreRules(dir, match, rules)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("读取目录失败 %s: %v", dir, err)
+	}
+
+	for _, e := range entries {
+		fullPath := filepath.Join(dir, e.Name())
+		info, err := os.Lstat(fullPath)
+		if err != nil {
+			return fmt.Errorf("获取文件信息失败 %s: %v", fullPath, err)
+		}
+
+		childMatch := path.Join(match, e.Name())
+		childRel := rel + "/" + e.Name()
+
+		if isSymlink(info) {
+			switch f.symlinkPolicy() {
+			case SymlinkSkip:
+				continue
+			case SymlinkPreserve:
+				if f.excluded(childMatch, false, rules) || !f.included(childMatch) {
+					continue
+				}
+				if err := fn(fullPath, childRel, info); err != nil {
+					return err
+				}
+				continue
+			default:
+				if info, err = os.Stat(fullPath); err != nil {
+					warn(fmt.Sprintf("跳过失效的符号链接 %s: %v", fullPath, err))
+					continue
+				}
+			}
+		}
+
+		// 跳过管道、设备等特殊文件
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+
+		if f.excluded(childMatch, info.IsDir(), rules) {
+			continue
+		}
+
+		if info.IsDir() {
+			if isAncestorLoop(info, ancestors) {
+				warn("跳过循环的符号链接 " + fullPath)
+				continue
+			}
+			if f.walksDirs() {
+				if err := fn(fullPath, childRel, info); err != nil {
+					return err
+				}
+			}
+			if err := f.walkDir(fullPath, childRel, childMatch, rules, append(ancestors, info), warn, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.included(childMatch) {
+			continue
+		}
+		if err := fn(fullPath, childRel, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
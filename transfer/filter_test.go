@@ -0,0 +1,206 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		base    string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		// 不含 / 的模式只匹配文件名，任意深度
+		{"*.log", "", "app.log", false, true},
+		{"*.log", "", "a/b/app.log", false, true},
+		{"*.log", "", "a/b/app.txt", false, false},
+		{"Thumbs.db", "", "pics/Thumbs.db", false, true},
+		// 以 / 开头或含 / 的模式相对规则所在目录锚定
+		{"/build", "", "build", true, true},
+		{"/build", "", "src/build", true, false},
+		{"docs/*.md", "", "docs/a.md", false, true},
+		{"docs/*.md", "", "docs/sub/a.md", false, false},
+		{"docs/*.md", "", "x/docs/a.md", false, false},
+		// ** 匹配零个或多个路径段
+		{"**/tmp", "", "tmp", true, true},
+		{"**/tmp", "", "a/b/tmp", true, true},
+		{"a/**/b", "", "a/b", false, true},
+		{"a/**/b", "", "a/x/y/b", false, true},
+		{"a/**/b", "", "c/a/x/b", false, false},
+		// 以 / 结尾的模式只匹配目录
+		{"out/", "", "out", true, true},
+		{"out/", "", "out", false, false},
+		{"out/", "", "src/out", true, true},
+		// 子目录中 .gitignore 的规则相对该目录
+		{"/gen", "sub", "sub/gen", true, true},
+		{"/gen", "sub", "gen", true, false},
+		{"/gen", "sub", "other/sub/gen", true, false},
+		{"*.tmp", "sub", "other/x.tmp", false, true},
+	}
+	for _, tt := range tests {
+		r, ok := parseRule(tt.pattern, tt.base)
+		if !ok {
+			t.Fatalf("parseRule(%q) 未返回规则", tt.pattern)
+		}
+		if got := r.matches(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("%q (base %q) 匹配 %q dir=%v = %v，期望 %v", tt.pattern, tt.base, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleModifiers(t *testing.T) {
+	tests := []struct {
+		line                       string
+		ok, negate, dirOnly, anchd bool
+		pattern                    string
+	}{
+		{"", false, false, false, false, ""},
+		{"# comment", false, false, false, false, ""},
+		{"  ", false, false, false, false, ""},
+		{"!keep.log", true, true, false, false, "keep.log"},
+		{"cache/", true, false, true, false, "cache"},
+		{"/root.txt", true, false, false, true, "root.txt"},
+		{"!/a/b/", true, true, true, true, "a/b"},
+		{"name.txt \r", true, false, false, false, "name.txt"},
+	}
+	for _, tt := range tests {
+		r, ok := parseRule(tt.line, "")
+		if ok != tt.ok {
+			t.Errorf("parseRule(%q) ok = %v，期望 %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if ok && (r.negate != tt.negate || r.dirOnly != tt.dirOnly || r.anchored != tt.anchd || r.pattern != tt.pattern) {
+			t.Errorf("parseRule(%q) = %+v", tt.line, r)
+		}
+	}
+}
+
+// writeTree 按相对路径创建文件，以 / 结尾的路径创建为目录
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if rel[len(rel)-1] == '/' {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFilterWalk(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "proj")
+	writeTree(t, root, map[string]string{
+		".gitignore":          "*.log\n!keep.log\n/only-root.txt\ncache/\n",
+		"main.go":             "",
+		"app.log":             "",
+		"keep.log":            "",
+		"only-root.txt":       "",
+		"cache/x":             "",
+		".git/HEAD":           "",
+		"node_modules/m/i.js": "",
+		"src/a.go":            "",
+		"src/a_test.log":      "",
+		"src/only-root.txt":   "",
+		"src/.gitignore":      "/gen/\n!debug.log\n",
+		"src/gen/g.go":        "",
+		"src/debug.log":       "",
+		"docs/empty/":         "",
+	})
+
+	tests := []struct {
+		name string
+		opts SendOptions
+		want []string
+	}{
+		{"无过滤", SendOptions{Presets: []string{"vcs"}, Exclude: []string{"node_modules/"}}, []string{
+			"proj", "proj/.gitignore", "proj/app.log", "proj/cache", "proj/cache/x",
+			"proj/docs", "proj/docs/empty", "proj/keep.log", "proj/main.go", "proj/only-root.txt",
+			"proj/src", "proj/src/.gitignore", "proj/src/a.go", "proj/src/a_test.log", "proj/src/debug.log",
+			"proj/src/gen", "proj/src/gen/g.go", "proj/src/only-root.txt",
+		}},
+		{"gitignore 与取反", SendOptions{Presets: []string{"vcs", "node"}, UseIgnoreFiles: true}, []string{
+			"proj", "proj/.gitignore", "proj/docs", "proj/docs/empty", "proj/keep.log", "proj/main.go",
+			"proj/src", "proj/src/.gitignore", "proj/src/a.go", "proj/src/debug.log", "proj/src/only-root.txt",
+		}},
+		{"包含模式只回调文件", SendOptions{Include: []string{"*.go"}, Exclude: []string{"**/gen"}, Presets: []string{"vcs"}}, []string{
+			"proj/main.go", "proj/src/a.go",
+		}},
+		{"锚定的包含模式", SendOptions{Include: []string{"src/*.log"}}, []string{
+			"proj/src/a_test.log", "proj/src/debug.log",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err = f.walk(root, "", func(fullPath, rel string, info os.FileInfo) error {
+				got = append(got, rel)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("遍历结果:\n%v\n期望:\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFilterErrors(t *testing.T) {
+	for _, opts := range []SendOptions{
+		{Presets: []string{"nope"}},
+		{Exclude: []string{"[a"}},
+		{Include: []string{"src/[z"}},
+		{SymlinkPolicy: "maybe"},
+	} {
+		if _, err := NewFilter(opts); err == nil {
+			t.Errorf("NewFilter(%+v) 应返回错误", opts)
+		}
+	}
+	if f, err := NewFilter(SendOptions{}); f != nil || err != nil {
+		t.Errorf("空选项应返回 nil 过滤器，得到 %v, %v", f, err)
+	}
+}
+
+func TestFilterWalkWarnsDanglingLink(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a.txt": "a"})
+	if err := os.Symlink("missing", filepath.Join(root, "dangling")); err != nil {
+		t.Skipf("不支持符号链接: %v", err)
+	}
+
+	var warnings []string
+	var rels []string
+	err := (*Filter)(nil).walkWarn(root, "r", func(msg string) { warnings = append(warnings, msg) }, func(fullPath, rel string, info os.FileInfo) error {
+		rels = append(rels, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "dangling") {
+		t.Errorf("warnings = %v", warnings)
+	}
+	if strings.Join(rels, ",") != "r,r/a.txt" {
+		t.Errorf("rels = %v", rels)
+	}
+}
@@ -0,0 +1,344 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 接收后钩子 ---------------------------
+// 钩子命令由系统 shell 执行（Windows 为 cmd /C，其他平台为 sh -c），工作目录为保存目录，
+// 通过以下环境变量获取会话信息：
+//
+//	LANFILE_EVENT     触发时机: file 或 session
+//	LANFILE_PEER      发送端地址
+//	LANFILE_ROOT      保存目录的绝对路径
+//	LANFILE_FILE      刚接收的文件的绝对路径（仅 file）
+//	LANFILE_REL_PATH  刚接收的文件相对保存目录的路径（仅 file）
+//	LANFILE_SIZE      刚接收的文件大小（仅 file）
+//	LANFILE_FILE_LIST 列出本次所有已接收文件绝对路径的文本文件，每行一个（仅 session）
+//	LANFILE_FILES     已接收的文件数
+//	LANFILE_BYTES     已接收的字节数
+//	LANFILE_OUTCOME   会话结果: completed、failed 或 canceled（仅 session）
+//	LANFILE_ERROR     会话失败原因（仅 session）
+const (
+	DefaultHookTimeout = 5 * time.Minute
+	hookOutputLimit    = 64 * 1024  // 每次执行最多保留的输出字节数
+	hookRecordOutput   = 256 * 1024 // 每次会话的摘要中所有钩子输出的总字节数上限
+	hookMaxResults     = 100        // 每次会话的摘要中最多保留的文件钩子结果数
+	hookWaitDelay      = 2 * time.Second
+)
+
+// Hooks 配置接收完成后执行的命令，为空的命令不执行
+type Hooks struct {
+	OnFile    string        // 每个文件接收完成后执行
+	OnSession string        // 会话结束后执行，无论成功与否
+	Timeout   time.Duration // 单次执行的超时，0 使用 DefaultHookTimeout
+}
+
+// HookResult 为一次钩子执行的结果
+type HookResult struct {
+	Event    string        `json:"event"`    // file 或 session
+	Command  string        `json:"command"`  // 执行的命令
+	File     string        `json:"file"`     // 触发的文件（相对保存目录），会话钩子为空
+	ExitCode int           `json:"exitCode"` // 退出码，未能启动或超时时为 -1
+	Output   string        `json:"output"`   // 标准输出与标准错误，超过上限时截断
+	Error    string        `json:"error"`    // 启动失败或超时的原因
+	Duration time.Duration `json:"duration"` // 执行耗时（纳秒）
+}
+
+// Failed 报告钩子是否未能正常执行或以非零退出码结束
+func (r HookResult) Failed() bool {
+	return r.Error != "" || r.ExitCode != 0
+}
+
+// Record 为一次接收会话的摘要，包括钩子的执行结果，供调用方记入传输历史
+type Record struct {
+	Peer     string       `json:"peer"`     // 发送端地址
+	Root     string       `json:"root"`     // 保存目录
+	Files    int          `json:"files"`    // 已接收的文件数
+	Bytes    int64        `json:"bytes"`    // 已接收的字节数
+	Outcome  string       `json:"outcome"`  // completed、failed 或 canceled
+	Error    string       `json:"error"`    // 失败原因
+	Started  time.Time    `json:"started"`  // 发送端连接的时间
+	Finished time.Time    `json:"finished"` // 会话结束的时间
+	Hooks    []HookResult `json:"hooks"`    // 钩子执行结果，超过 hookMaxResults 个时优先保留失败的
+	Dups     []Duplicate  `json:"dups"`     // 由已接收文件复制得到的去重副本
+
+	HooksFailed  int `json:"hooksFailed"`  // 执行失败的钩子数，包括未保留结果的
+	HooksOmitted int `json:"hooksOmitted"` // 超过上限未保留结果的钩子数
+}
+
+// outcomeOf 将会话错误转换为结果描述
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return "completed"
+	case errors.Is(err, ErrCanceled):
+		return "canceled"
+	default:
+		return "failed"
+	}
+}
+
+// hookRunner 在后台按接收顺序依次执行文件钩子，不阻塞接收；会话钩子在所有文件钩子完成后执行。
+// 钩子执行跟不上接收、排队的文件达到 hookQueueSize 时，之后的文件跳过钩子并记为失败。
+type hookRunner struct {
+	hooks Hooks
+	peer  string
+	root  string
+	queue chan hookJob
+	done  chan struct{}
+
+	mu      sync.Mutex
+	files   []string // 已接收文件的绝对路径
+	bytes   int64
+	results []HookResult
+	output  int // results 中输出的总字节数
+	failed  int
+	omitted int
+	dups    []Duplicate
+}
+
+const hookQueueSize = 1024 // 等待执行文件钩子的最大文件数
+
+type hookJob struct {
+	path    string
+	relPath string
+	size    int64
+}
+
+func newHookRunner(hooks Hooks, peer, root string) *hookRunner {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	h := &hookRunner{hooks: hooks, peer: peer, root: root}
+	if hooks.OnFile != "" {
+		h.queue = make(chan hookJob, hookQueueSize)
+		h.done = make(chan struct{})
+		go h.work()
+	}
+	return h
+}
+
+func (h *hookRunner) work() {
+	defer close(h.done)
+	for job := range h.queue {
+		h.mu.Lock()
+		env := append(h.baseEnv(),
+			"LANFILE_EVENT=file",
+			"LANFILE_FILE="+job.path,
+			"LANFILE_REL_PATH="+job.relPath,
+			"LANFILE_SIZE="+strconv.FormatInt(job.size, 10),
+		)
+		h.mu.Unlock()
+		h.record(h.run("file", h.hooks.OnFile, job.relPath, env))
+	}
+}
+
+// baseEnv 返回各钩子共用的环境变量，调用方需持有 mu
+func (h *hookRunner) baseEnv() []string {
+	return append(os.Environ(),
+		"LANFILE_PEER="+h.peer,
+		"LANFILE_ROOT="+h.root,
+		"LANFILE_FILES="+strconv.Itoa(len(h.files)),
+		"LANFILE_BYTES="+strconv.FormatInt(h.bytes, 10),
+	)
+}
+
+// fileDone 记录一个已接收的文件并排队执行文件钩子，队列已满时不等待，直接记录跳过
+func (h *hookRunner) fileDone(path, relPath string, size int64) {
+	h.mu.Lock()
+	h.files = append(h.files, path)
+	h.bytes += size
+	h.mu.Unlock()
+	if h.queue == nil {
+		return
+	}
+	select {
+	case h.queue <- hookJob{path: path, relPath: relPath, size: size}:
+	default:
+		h.record(HookResult{Event: "file", Command: h.hooks.OnFile, File: relPath, ExitCode: -1, Error: "等待执行的钩子过多，已跳过"})
+	}
+}
+
+// duplicate 记录一个去重的副本
+func (h *hookRunner) duplicate(d Duplicate) {
+	h.mu.Lock()
+	h.dups = append(h.dups, d)
+	h.mu.Unlock()
+}
+
+// finish 等待文件钩子执行完毕，然后执行会话钩子并返回会话摘要
+func (h *hookRunner) finish(started time.Time, sessionErr error) Record {
+	if h.queue != nil {
+		close(h.queue)
+		<-h.done
+	}
+
+	outcome := outcomeOf(sessionErr)
+	errText := ""
+	if sessionErr != nil {
+		errText = sessionErr.Error()
+	}
+
+	if h.hooks.OnSession != "" {
+		h.mu.Lock()
+		env := append(h.baseEnv(),
+			"LANFILE_EVENT=session",
+			"LANFILE_OUTCOME="+outcome,
+			"LANFILE_ERROR="+errText,
+		)
+		files := strings.Join(h.files, "\n")
+		h.mu.Unlock()
+
+		listPath, err := writeFileList(files)
+		if err != nil {
+			h.record(HookResult{Event: "session", Command: h.hooks.OnSession, ExitCode: -1, Error: err.Error()})
+		} else {
+			env = append(env, "LANFILE_FILE_LIST="+listPath)
+			h.record(h.run("session", h.hooks.OnSession, "", env))
+			os.Remove(listPath)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Record{
+		Peer:     h.peer,
+		Root:     h.root,
+		Files:    len(h.files),
+		Bytes:    h.bytes,
+		Outcome:  outcome,
+		Error:    errText,
+		Started:  started,
+		Finished: time.Now(),
+		Hooks:    h.results,
+		Dups:     h.dups,
+
+		HooksFailed:  h.failed,
+		HooksOmitted: h.omitted,
+	}
+}
+
+// writeFileList 将文件列表写入临时文件，供会话钩子读取
+func writeFileList(files string) (string, error) {
+	f, err := os.CreateTemp("", "lanfile-files-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("创建文件列表失败: %v", err)
+	}
+	if files != "" {
+		files += "\n"
+	}
+	_, err = f.WriteString(files)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("写入文件列表失败: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// record 保存一次钩子执行的结果。摘要会记入传输历史，因此文件钩子最多保留 hookMaxResults 个结果，
+// 已满时失败的结果替换最早的成功结果；所有结果的输出合计不超过 hookRecordOutput，超出部分截断。
+func (h *hookRunner) record(res HookResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if res.Failed() {
+		h.failed++
+	}
+	if res.Event == "file" && len(h.results) >= hookMaxResults {
+		i := -1
+		if res.Failed() {
+			i = slices.IndexFunc(h.results, func(r HookResult) bool { return !r.Failed() })
+		}
+		h.omitted++
+		if i < 0 {
+			return
+		}
+		h.output -= len(h.results[i].Output)
+		h.results = slices.Delete(h.results, i, i+1)
+	}
+	if room := max(hookRecordOutput-h.output, 0); len(res.Output) > room {
+		res.Output = strings.ToValidUTF8(res.Output[:room], "") + "\n...（输出已截断）"
+	}
+	h.output += len(res.Output)
+	h.results = append(h.results, res)
+}
+
+// run 执行一次钩子命令，超时后结束进程
+func (h *hookRunner) run(event, command, file string, env []string) HookResult {
+	timeout := h.hooks.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = h.root
+	cmd.Env = env
+	out := &limitedBuffer{limit: hookOutputLimit}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// 命令派生的子进程可能继续占用输出管道，超时后最多再等待 hookWaitDelay
+	cmd.WaitDelay = hookWaitDelay
+
+	start := time.Now()
+	err := cmd.Run()
+	res := HookResult{
+		Event:    event,
+		Command:  command,
+		File:     file,
+		ExitCode: -1,
+		Output:   out.String(),
+		Duration: time.Since(start),
+	}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.Error = fmt.Sprintf("执行超时 (%v)", timeout)
+	case err != nil && !errors.As(err, &exitErr):
+		res.Error = fmt.Sprintf("执行失败: %v", err)
+	}
+	return res
+}
+
+// limitedBuffer 只保留前 limit 个字节的输出，其余丢弃
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n...（输出已截断）"
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package transfer
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand 通过 sh 执行钩子命令
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 钩子执行跟不上时，接收不应因队列已满而停下
+func TestHookQueueFullDoesNotBlock(t *testing.T) {
+	h := &hookRunner{hooks: Hooks{OnFile: "true"}, queue: make(chan hookJob, 1)}
+
+	done := make(chan struct{})
+	go func() {
+		h.fileDone("/d/a", "a", 1)
+		h.fileDone("/d/b", "b", 2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("队列已满时 fileDone 被阻塞")
+	}
+
+	if len(h.files) != 2 || h.bytes != 3 {
+		t.Errorf("files = %v, bytes = %d", h.files, h.bytes)
+	}
+	if len(h.results) != 1 || h.results[0].File != "b" || !h.results[0].Failed() {
+		t.Errorf("results = %+v，应记录 b 被跳过", h.results)
+	}
+	if job := <-h.queue; job.relPath != "a" {
+		t.Errorf("排队的文件 = %s", job.relPath)
+	}
+}
+
+// 文件很多时摘要中的钩子结果和输出有上限，失败的结果优先保留
+func TestHookRecordBounded(t *testing.T) {
+	h := &hookRunner{}
+	big := strings.Repeat("x", hookOutputLimit)
+	for i := range 3 * hookMaxResults {
+		res := HookResult{Event: "file", File: strconv.Itoa(i), Output: big}
+		if i%50 == 49 {
+			res.ExitCode = 1
+		}
+		h.record(res)
+	}
+	h.record(HookResult{Event: "session", ExitCode: 2})
+	rec := h.finish(time.Now(), nil)
+
+	if len(rec.Hooks) != hookMaxResults+1 {
+		t.Errorf("保留了 %d 个结果，应为 %d", len(rec.Hooks), hookMaxResults+1)
+	}
+	if rec.HooksFailed != 7 || rec.HooksOmitted != 2*hookMaxResults {
+		t.Errorf("失败 %d 个，未保留 %d 个", rec.HooksFailed, rec.HooksOmitted)
+	}
+	failed, output := 0, 0
+	for _, res := range rec.Hooks {
+		if res.Failed() {
+			failed++
+		}
+		output += len(res.Output)
+	}
+	if failed != 7 {
+		t.Errorf("保留了 %d 个失败的结果，应全部保留", failed)
+	}
+	if output > hookRecordOutput+len(rec.Hooks)*64 {
+		t.Errorf("保留的输出共 %d 字节，超过上限", output)
+	}
+	if last := rec.Hooks[len(rec.Hooks)-1]; last.Event != "session" {
+		t.Errorf("会话钩子的结果未保留: %+v", last)
+	}
+}
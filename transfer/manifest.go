@@ -0,0 +1,130 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --------------------------- 清单协议 ---------------------------
+const (
+	ManifestMarker = "MANIFEST"
+	RootMarker     = "ROOT"
+
+	manifestMaxRoots = 1 << 16 // 一次会话最多的发送根数，限制对端声明的数量
+)
+
+// sendRoot 为一次会话中的一个发送根（文件或文件夹）
+type sendRoot struct {
+	Path  string // 本地路径
+	Name  string // 接收端使用的名称，同名根会被重命名
+	IsDir bool
+}
+
+// buildSendRoots 检查所有路径并为同名根分配不冲突的名称，如 "a.txt" 与 "a (2).txt"
+func buildSendRoots(paths []string) ([]sendRoot, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("未选择要发送的文件")
+	}
+	if len(paths) > manifestMaxRoots {
+		return nil, fmt.Errorf("一次最多发送 %d 个文件或文件夹", manifestMaxRoots)
+	}
+
+	used := make(map[string]bool)
+	roots := make([]sendRoot, 0, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("文件不存在: %v", err)
+		}
+
+		name := fi.Name()
+		ext := ""
+		if !fi.IsDir() {
+			ext = filepath.Ext(name)
+		}
+		stem := strings.TrimSuffix(name, ext)
+		for i := 2; used[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		used[strings.ToLower(name)] = true
+
+		roots = append(roots, sendRoot{Path: p, Name: name, IsDir: fi.IsDir()})
+	}
+	return roots, nil
+}
+
+func rootFlag(isDir bool) string {
+	if isDir {
+		return "DIR"
+	}
+	return "FILE"
+}
+
+// writeManifest 发送会话清单。单个根时沿用旧的 "名称|类型" 格式，以兼容旧版接收端。
+func writeManifest(conn net.Conn, roots []sendRoot) error {
+	var b strings.Builder
+	if len(roots) == 1 {
+		fmt.Fprintf(&b, "%s|%s\n", roots[0].Name, rootFlag(roots[0].IsDir))
+	} else {
+		fmt.Fprintf(&b, "%s|%d\n", ManifestMarker, len(roots))
+		for _, r := range roots {
+			fmt.Fprintf(&b, "%s|%s|%s\n", RootMarker, r.Name, rootFlag(r.IsDir))
+		}
+	}
+	_, err := conn.Write([]byte(b.String()))
+	return err
+}
+
+// readManifest 读取会话清单，返回各根名称及是否为文件夹
+func readManifest(reader *bufio.Reader) ([]sendRoot, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("读取元数据失败: %v", err)
+	}
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("元数据格式错误")
+	}
+
+	if parts[0] != ManifestMarker {
+		return []sendRoot{{Name: parts[0], IsDir: parts[1] == "DIR"}}, nil
+	}
+
+	count, err := strconv.Atoi(parts[1])
+	if err != nil || count <= 0 || count > manifestMaxRoots {
+		return nil, fmt.Errorf("元数据格式错误")
+	}
+	// 数量来自对端，按实际收到的行追加而不预先分配
+	var roots []sendRoot
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("读取元数据失败: %v", err)
+		}
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) != 3 || parts[0] != RootMarker {
+			return nil, fmt.Errorf("元数据格式错误")
+		}
+		roots = append(roots, sendRoot{Name: parts[1], IsDir: parts[2] == "DIR"})
+	}
+	return roots, nil
+}
+
+// safeJoin 将发送方提供的斜杠路径拼接到 dir 下，拒绝绝对路径和越出 dir 的路径
+func safeJoin(dir, rel string) (string, error) {
+	local := filepath.FromSlash(rel)
+	if rel == "" || filepath.IsAbs(local) || filepath.VolumeName(local) != "" || strings.HasPrefix(rel, "/") {
+		return "", fmt.Errorf("非法路径: %s", rel)
+	}
+	cleaned := filepath.Clean(local)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("非法路径: %s", rel)
+	}
+	return filepath.Join(dir, cleaned), nil
+}
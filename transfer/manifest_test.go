@@ -0,0 +1,67 @@
+package transfer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 对端声明的根数量过大时应拒绝，不能按声明的数量分配内存
+func TestReadManifestCountLimit(t *testing.T) {
+	for _, count := range []string{"4611686018427387904", strconv.Itoa(manifestMaxRoots + 1), "0", "-1", "x"} {
+		stream := ManifestMarker + "|" + count + "\n" + RootMarker + "|a.txt|FILE\n"
+		if _, err := readManifest(bufio.NewReader(strings.NewReader(stream))); err == nil {
+			t.Errorf("根数量 %s 应被拒绝", count)
+		}
+	}
+
+	// 声明的数量多于实际发送的行
+	stream := ManifestMarker + "|1000\n" + RootMarker + "|a.txt|FILE\n"
+	if _, err := readManifest(bufio.NewReader(strings.NewReader(stream))); err == nil {
+		t.Error("清单不完整时应失败")
+	}
+}
+
+func TestReceiverRejectsOversizedManifest(t *testing.T) {
+	dest := t.TempDir()
+	stream := ManifestMarker + "|4611686018427387904\n" + RootMarker + "|a.txt|FILE\n" + EndMarker + "\n"
+	if err := receiveRaw(t, &Receiver{Dir: dest}, stream); err == nil {
+		t.Error("超大的根数量应导致接收失败")
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/x.txt": "x", "b.txt": "b"})
+	if err := os.MkdirAll(filepath.Join(dir, "c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := buildSendRoots([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]sendRoot{roots[1:2], roots} {
+		a, b := net.Pipe()
+		go func() {
+			writeManifest(a, want)
+			a.Close()
+		}()
+		got, err := readManifest(bufio.NewReader(b))
+		b.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("读取到 %d 个根，应为 %d", len(got), len(want))
+		}
+		for i := range got {
+			if got[i].Name != want[i].Name || got[i].IsDir != want[i].IsDir {
+				t.Errorf("根 %d = %+v，应为 %+v", i, got[i], want[i])
+			}
+		}
+	}
+}
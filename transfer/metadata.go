@@ -0,0 +1,138 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------- 条目头协议 ---------------------------
+// 文件头: FILE_START|相对路径|大小|权限(八进制)|修改时间(Unix 纳秒)
+// 目录头: DIR_START|相对路径|权限(八进制)|修改时间(Unix 纳秒)
+// 链接头: LINK_START|相对路径|链接目标(斜杠路径)
+// 归档头: ARCHIVE_START|归档文件名|格式|权限(八进制)|修改时间(Unix 纳秒)，内容为数据块序列
+// 流式文件头: STREAM_START|相对路径|权限(八进制)|修改时间(Unix 纳秒)，大小在数据块结束后才确定
+// 旧版发送端的文件头只有前三个字段，此时不恢复元数据。
+const DirHeaderPrefix = "DIR_START"
+
+// entryHeader 为解析后的文件或目录头
+type entryHeader struct {
+	IsDir         bool
+	IsLink        bool
+	LinkTarget    string
+	IsSparse      bool
+	IsDelta       bool // 差异文件头，内容为差异操作流
+	IsDup         bool
+	IsStream      bool   // 流式文件头，大小未知，内容为数据块序列
+	IsArchive     bool   // 归档头，内容为数据块序列
+	ArchiveFormat string // 归档格式: tar, tar.gz, zip
+	DupSource     string // 去重头指向的原文件相对路径
+	ExtentCount   int    // 稀疏文件头之后的数据段行数
+	RelPath       string
+	Size          int64
+	Mode          os.FileMode
+	ModTime       time.Time
+	HasMeta       bool // 是否携带权限和修改时间
+}
+
+func formatFileHeader(rel string, info os.FileInfo) string {
+	return fmt.Sprintf("%s|%s|%d|%o|%d\n", FileHeaderPrefix, rel, info.Size(), info.Mode().Perm(), info.ModTime().UnixNano())
+}
+
+func formatDirHeader(rel string, info os.FileInfo) string {
+	return fmt.Sprintf("%s|%s|%o|%d\n", DirHeaderPrefix, rel, info.Mode().Perm(), info.ModTime().UnixNano())
+}
+
+func formatLinkHeader(rel, target string) string {
+	return fmt.Sprintf("%s|%s|%s\n", LinkHeaderPrefix, rel, filepath.ToSlash(target))
+}
+
+// parseEntryHeader 解析文件头或目录头
+func parseEntryHeader(line string) (entryHeader, error) {
+	hdr := strings.Split(line, "|")
+	var h entryHeader
+	var metaFields []string
+
+	switch {
+	case hdr[0] == FileHeaderPrefix && (len(hdr) == 3 || len(hdr) == 5):
+		size, err := strconv.ParseInt(hdr[2], 10, 64)
+		if err != nil || size < 0 {
+			return h, fmt.Errorf("文件头格式错误")
+		}
+		h.RelPath, h.Size = hdr[1], size
+		metaFields = hdr[3:]
+	case hdr[0] == DirHeaderPrefix && len(hdr) == 4:
+		h.IsDir, h.RelPath = true, hdr[1]
+		metaFields = hdr[2:]
+	case hdr[0] == SparseHeaderPrefix && len(hdr) == 6:
+		size, err := strconv.ParseInt(hdr[2], 10, 64)
+		count, err2 := strconv.Atoi(hdr[5])
+		if err != nil || err2 != nil || size < 0 || count < 0 || count > sparseMaxExtents {
+			return h, fmt.Errorf("文件头格式错误")
+		}
+		h.IsSparse, h.RelPath, h.Size, h.ExtentCount = true, hdr[1], size, count
+		metaFields = hdr[3:5]
+	case hdr[0] == DeltaHeaderPrefix && len(hdr) == 5:
+		size, err := strconv.ParseInt(hdr[2], 10, 64)
+		if err != nil || size < 0 {
+			return h, fmt.Errorf("文件头格式错误")
+		}
+		h.IsDelta, h.RelPath, h.Size = true, hdr[1], size
+		metaFields = hdr[3:]
+	case hdr[0] == DupHeaderPrefix && len(hdr) == 6:
+		size, err := strconv.ParseInt(hdr[2], 10, 64)
+		if err != nil || size < 0 || hdr[5] == "" {
+			return h, fmt.Errorf("文件头格式错误")
+		}
+		h.IsDup, h.RelPath, h.Size, h.DupSource = true, hdr[1], size, hdr[5]
+		metaFields = hdr[3:5]
+	case hdr[0] == StreamHeaderPrefix && len(hdr) == 4:
+		h.IsStream, h.RelPath = true, hdr[1]
+		metaFields = hdr[2:]
+	case hdr[0] == ArchiveHeaderPrefix && len(hdr) == 5:
+		if hdr[2] == "" || !validArchiveFormat(hdr[2]) {
+			return h, fmt.Errorf("未知的归档格式: %s", hdr[2])
+		}
+		h.IsArchive, h.RelPath, h.ArchiveFormat = true, hdr[1], hdr[2]
+		metaFields = hdr[3:]
+	case hdr[0] == LinkHeaderPrefix && len(hdr) == 3:
+		h.IsLink, h.RelPath, h.LinkTarget = true, hdr[1], hdr[2]
+		return h, nil
+	case hdr[0] == FileHeaderPrefix || hdr[0] == DirHeaderPrefix || hdr[0] == LinkHeaderPrefix || hdr[0] == SparseHeaderPrefix || hdr[0] == DeltaHeaderPrefix || hdr[0] == DupHeaderPrefix || hdr[0] == StreamHeaderPrefix || hdr[0] == ArchiveHeaderPrefix:
+		return h, fmt.Errorf("文件头格式错误")
+	default:
+		return h, fmt.Errorf("无效的文件头格式")
+	}
+
+	if len(metaFields) == 2 {
+		mode, err := strconv.ParseUint(metaFields[0], 8, 32)
+		if err != nil {
+			return h, fmt.Errorf("文件头格式错误")
+		}
+		mtime, err := strconv.ParseInt(metaFields[1], 10, 64)
+		if err != nil {
+			return h, fmt.Errorf("文件头格式错误")
+		}
+		h.Mode = os.FileMode(mode).Perm()
+		h.ModTime = time.Unix(0, mtime)
+		h.HasMeta = true
+	}
+	return h, nil
+}
+
+// applyMetadata 恢复权限和修改时间
+func applyMetadata(path string, h entryHeader) error {
+	if !h.HasMeta {
+		return nil
+	}
+	if err := os.Chmod(path, h.Mode); err != nil {
+		return fmt.Errorf("恢复权限失败 %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, h.ModTime, h.ModTime); err != nil {
+		return fmt.Errorf("恢复修改时间失败 %s: %v", path, err)
+	}
+	return nil
+}
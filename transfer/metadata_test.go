@@ -0,0 +1,104 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "tree")
+	writeTree(t, src, map[string]string{
+		"run.sh":         "#!/bin/sh\n",
+		"secret.txt":     "s",
+		"sub/data.bin":   "data",
+		"empty/":         "",
+		"sub/deep/none/": "",
+	})
+	modes := map[string]os.FileMode{
+		"run.sh":       0755,
+		"secret.txt":   0600,
+		"sub/data.bin": 0640,
+		"empty":        0700,
+		"sub":          0750,
+	}
+	for rel, mode := range modes {
+		if err := os.Chmod(filepath.Join(src, rel), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 目录的修改时间最后设置，避免被其中文件的创建改变
+	base := time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	mtimes := map[string]time.Time{
+		"run.sh":        base,
+		"secret.txt":    base.Add(time.Hour),
+		"sub/data.bin":  base.Add(2 * time.Hour),
+		"sub/deep/none": base.Add(3 * time.Hour),
+		"empty":         base.Add(4 * time.Hour),
+		"sub":           base.Add(5 * time.Hour),
+	}
+	for _, rel := range []string{"run.sh", "secret.txt", "sub/data.bin", "sub/deep/none", "empty", "sub"} {
+		if err := os.Chtimes(filepath.Join(src, rel), mtimes[rel], mtimes[rel]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := t.TempDir()
+	sendErr, recvErr := sendLoopback(t, &Sender{}, &Receiver{Dir: dest, PreserveMetadata: true}, []string{src}, nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("发送: %v, 接收: %v", sendErr, recvErr)
+	}
+
+	got := filepath.Join(dest, "tree")
+	for rel, mode := range modes {
+		info, err := os.Stat(filepath.Join(got, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Windows 只有只读属性，不检查权限位
+		if runtime.GOOS != "windows" && info.Mode().Perm() != mode {
+			t.Errorf("%s 权限为 %v，期望 %v", rel, info.Mode().Perm(), mode)
+		}
+	}
+	for rel, mtime := range mtimes {
+		info, err := os.Stat(filepath.Join(got, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s 修改时间为 %v，期望 %v", rel, info.ModTime(), mtime)
+		}
+	}
+	for _, rel := range []string{"empty", "sub/deep/none"} {
+		entries, err := os.ReadDir(filepath.Join(got, rel))
+		if err != nil {
+			t.Errorf("空目录 %s 未创建: %v", rel, err)
+		} else if len(entries) != 0 {
+			t.Errorf("空目录 %s 不为空", rel)
+		}
+	}
+}
+
+func TestMetadataNotPreserved(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(src, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(src, old, old)
+
+	dest := t.TempDir()
+	sendErr, recvErr := sendLoopback(t, &Sender{}, &Receiver{Dir: dest}, []string{src}, nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("发送: %v, 接收: %v", sendErr, recvErr)
+	}
+	info, err := os.Stat(filepath.Join(dest, "f.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(old) {
+		t.Error("未开启 PreserveMetadata 时不应恢复修改时间")
+	}
+}
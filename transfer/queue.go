@@ -0,0 +1,593 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --------------------------- 发送队列 ---------------------------
+const (
+	DefaultQueueRetries = 3               // 任务失败后的默认重试次数
+	queueTick           = time.Second     // 检查可开始任务的间隔
+	queueRetryMin       = 5 * time.Second // 失败后的首次重试间隔
+	queueRetryMax       = 5 * time.Minute // 重试间隔上限
+	queueFinishedLimit  = 100             // 保留的已结束任务数，超出时移除最早结束的
+)
+
+// 任务状态
+const (
+	JobQueued    = "queued"    // 等待开始，可能在等待时间窗口或重试
+	JobRunning   = "running"   // 正在发送
+	JobCompleted = "completed" // 发送成功
+	JobFailed    = "failed"    // 重试次数用尽
+	JobCanceled  = "canceled"  // 被取消
+)
+
+// TimeWindow 为每天允许开始任务的时间段，格式为本地时间 "HH:MM"。Start 晚于 End 时跨越午夜，
+// 如 "22:00" 到 "06:00"。两者都为空或相同时不限制。已开始的任务在时间段结束时不会中止。
+type TimeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Job 为发送队列中的一个任务
+type Job struct {
+	ID        int         `json:"id"`
+	Paths     []string    `json:"paths"`     // 要发送的文件和文件夹
+	Target    string      `json:"target"`    // 接收端地址，为空时每次尝试前自动发现
+	Options   SendOptions `json:"options"`   // 过滤和发送选项
+	Priority  int         `json:"priority"`  // 越大越先开始，相同时按队列顺序
+	Window    TimeWindow  `json:"window"`    // 允许开始的时间段
+	Retries   int         `json:"retries"`   // 失败后的重试次数，0 使用 DefaultQueueRetries，负数表示不重试
+	State     string      `json:"state"`     // 任务状态
+	Attempts  int         `json:"attempts"`  // 已开始的次数
+	LastError string      `json:"lastError"` // 最近一次失败的原因，成功后清空
+	NextRun   time.Time   `json:"nextRun"`   // 等待时间窗口或重试时最早的开始时间
+	Added     time.Time   `json:"added"`     // 加入队列的时间
+	Finished  time.Time   `json:"finished"`  // 结束的时间
+	Stats     Stats       `json:"stats"`     // 当前或最近一次尝试的统计信息
+}
+
+// finished 报告任务是否已结束，不会再自动开始
+func (j *Job) finished() bool {
+	return j.State == JobCompleted || j.State == JobFailed || j.State == JobCanceled
+}
+
+// QueueObserver 接收发送队列的变化，回调可能来自队列或发送所在的 goroutine，实现不应阻塞
+type QueueObserver interface {
+	QueueChanged(jobs []Job) // 任务增删或顺序变化，参数为整个队列
+	JobUpdated(job Job)      // 单个任务的状态或进度变化
+}
+
+// Queue 按优先级依次执行发送任务，同时最多执行 Concurrency 个。
+// 失败的任务按指数退避重试；设置 QueueFile 后队列写入该文件，重新启动时继续未完成的任务，
+// 退出时进行中的任务重新排队。Run 之外的方法可在任意 goroutine 调用，写入队列文件失败时修改仍然生效并返回错误。
+type Queue struct {
+	QueueFile   string         // 队列文件路径，为空时不持久化
+	Concurrency int            // 同时进行的任务数，0 表示 1
+	Observer    QueueObserver  // 队列观察者，可为 nil
+	Limiters    []*RateLimiter // 发送时依次申请令牌的令牌桶
+
+	mu       sync.Mutex
+	jobs     []*Job // 队列顺序，优先级相同时靠前的先开始
+	nextID   int
+	running  map[int]*Sender
+	wake     chan struct{}
+	stopping bool // Run 正在退出，被取消的任务重新排队
+}
+
+// queueState 为写入队列文件的内容
+type queueState struct {
+	NextID int    `json:"nextId"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+// jobResult 为一次尝试的结果
+type jobResult struct {
+	id  int
+	err error
+}
+
+// init 首次使用时初始化并读取队列文件，调用时须持有 mu
+func (q *Queue) init() {
+	if q.wake != nil {
+		return
+	}
+	q.wake = make(chan struct{}, 1)
+	q.running = make(map[int]*Sender)
+	q.nextID = 1
+	if q.QueueFile == "" {
+		return
+	}
+	data, err := os.ReadFile(q.QueueFile)
+	if err != nil {
+		return
+	}
+	var state queueState
+	if json.Unmarshal(data, &state) != nil {
+		return
+	}
+	for _, j := range state.Jobs {
+		// 上次退出时进行中的任务重新排队
+		if j.State == JobRunning {
+			j.State = JobQueued
+		}
+		q.jobs = append(q.jobs, j)
+		q.nextID = max(q.nextID, j.ID+1)
+	}
+	q.nextID = max(q.nextID, state.NextID)
+}
+
+// save 将队列写入队列文件，调用时须持有 mu。调度中的写入失败被忽略，下次修改队列时再次写入。
+func (q *Queue) save() error {
+	if q.QueueFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(queueState{NextID: q.nextID, Jobs: q.jobs})
+	if err == nil {
+		err = writeFileAtomic(q.QueueFile, data)
+	}
+	if err != nil {
+		return fmt.Errorf("保存发送队列失败: %v", err)
+	}
+	return nil
+}
+
+// notify 唤醒 Run 重新检查可开始的任务，调用时须持有 mu
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// find 返回 id 对应的任务及其位置，调用时须持有 mu
+func (q *Queue) find(id int) (*Job, int) {
+	for i, j := range q.jobs {
+		if j.ID == id {
+			return j, i
+		}
+	}
+	return nil, -1
+}
+
+func (q *Queue) snapshot() []Job {
+	jobs := make([]Job, len(q.jobs))
+	for i, j := range q.jobs {
+		jobs[i] = *j
+	}
+	return jobs
+}
+
+// changed 保存队列并在释放锁后通知观察者整个队列，返回保存的错误。调用时须持有 mu，返回时已释放。
+func (q *Queue) changed() error {
+	err := q.save()
+	q.notify()
+	jobs := q.snapshot()
+	q.mu.Unlock()
+	if q.Observer != nil {
+		q.Observer.QueueChanged(jobs)
+	}
+	return err
+}
+
+// updated 在释放锁后通知观察者单个任务的变化，调用时须持有 mu，返回时已释放
+func (q *Queue) updated(j *Job) {
+	job := *j
+	q.mu.Unlock()
+	if q.Observer != nil {
+		q.Observer.JobUpdated(job)
+	}
+}
+
+// --------------------------- 队列操作 ---------------------------
+// Jobs 返回队列中的所有任务，按队列顺序排列
+func (q *Queue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.init()
+	return q.snapshot()
+}
+
+// Add 将发送任务加入队列末尾，返回分配了编号的任务。job 中的状态字段被忽略。
+func (q *Queue) Add(job Job) (Job, error) {
+	if len(job.Paths) == 0 {
+		return Job{}, fmt.Errorf("未选择要发送的文件")
+	}
+	if _, err := NewFilter(job.Options); err != nil {
+		return Job{}, err
+	}
+	if !validArchiveFormat(job.Options.Archive) {
+		return Job{}, fmt.Errorf("未知的归档格式: %s", job.Options.Archive)
+	}
+	if err := job.Window.validate(); err != nil {
+		return Job{}, err
+	}
+
+	q.mu.Lock()
+	q.init()
+	j := &Job{
+		ID:       q.nextID,
+		Paths:    slices.Clone(job.Paths),
+		Target:   job.Target,
+		Options:  job.Options,
+		Priority: job.Priority,
+		Window:   job.Window,
+		Retries:  job.Retries,
+		State:    JobQueued,
+		Added:    time.Now(),
+	}
+	q.nextID++
+	q.jobs = append(q.jobs, j)
+	added := *j
+	return added, q.changed()
+}
+
+// Remove 从队列中移除任务，进行中的任务先被取消
+func (q *Queue) Remove(id int) error {
+	q.mu.Lock()
+	q.init()
+	_, i := q.find(id)
+	if i < 0 {
+		q.mu.Unlock()
+		return fmt.Errorf("任务不存在: %d", id)
+	}
+	if sender := q.running[id]; sender != nil {
+		sender.Cancel()
+	}
+	q.jobs = slices.Delete(q.jobs, i, i+1)
+	return q.changed()
+}
+
+// Cancel 取消任务，进行中的发送被中止，任务保留在队列中直到被移除或重试
+func (q *Queue) Cancel(id int) error {
+	q.mu.Lock()
+	q.init()
+	j, _ := q.find(id)
+	if j == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("任务不存在: %d", id)
+	}
+	if j.finished() {
+		q.mu.Unlock()
+		return fmt.Errorf("任务已结束")
+	}
+	if sender := q.running[id]; sender != nil {
+		sender.Cancel()
+	}
+	j.State = JobCanceled
+	j.NextRun = time.Time{}
+	j.Finished = time.Now()
+	err := q.save()
+	q.updated(j)
+	return err
+}
+
+// Retry 将失败或取消的任务重新排队并重置尝试次数；对等待重试的任务则立即开始
+func (q *Queue) Retry(id int) error {
+	q.mu.Lock()
+	q.init()
+	j, _ := q.find(id)
+	if j == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("任务不存在: %d", id)
+	}
+	switch j.State {
+	case JobFailed, JobCanceled:
+		j.State = JobQueued
+		j.Attempts = 0
+		j.LastError = ""
+		j.Finished = time.Time{}
+	case JobQueued:
+	default:
+		q.mu.Unlock()
+		return fmt.Errorf("任务正在进行或已完成")
+	}
+	j.NextRun = time.Time{}
+	err := q.save()
+	q.notify()
+	q.updated(j)
+	return err
+}
+
+// Move 将任务移动到队列中的 index 位置，超出范围时移到开头或末尾
+func (q *Queue) Move(id, index int) error {
+	q.mu.Lock()
+	q.init()
+	j, i := q.find(id)
+	if j == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("任务不存在: %d", id)
+	}
+	q.jobs = slices.Delete(q.jobs, i, i+1)
+	index = min(max(index, 0), len(q.jobs))
+	q.jobs = slices.Insert(q.jobs, index, j)
+	return q.changed()
+}
+
+// SetPriority 修改任务的优先级，越大越先开始
+func (q *Queue) SetPriority(id, priority int) error {
+	q.mu.Lock()
+	q.init()
+	j, _ := q.find(id)
+	if j == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("任务不存在: %d", id)
+	}
+	j.Priority = priority
+	return q.changed()
+}
+
+// SetConcurrency 修改同时进行的任务数，减少时进行中的任务不受影响
+func (q *Queue) SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("同时进行的任务数至少为 1")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.init()
+	q.Concurrency = n
+	q.notify()
+	return nil
+}
+
+// ClearFinished 移除所有已结束的任务
+func (q *Queue) ClearFinished() error {
+	q.mu.Lock()
+	q.init()
+	q.jobs = slices.DeleteFunc(q.jobs, func(j *Job) bool { return j.finished() })
+	return q.changed()
+}
+
+// --------------------------- 调度 ---------------------------
+// Run 开始执行队列中的任务，阻塞到 quit 关闭。进行中的任务被取消并重新排队。
+func (q *Queue) Run(quit <-chan struct{}) {
+	q.mu.Lock()
+	q.init()
+	wake := q.wake
+	q.mu.Unlock()
+
+	tick := time.NewTicker(queueTick)
+	defer tick.Stop()
+	results := make(chan jobResult)
+
+	for {
+		q.startReady(time.Now(), results)
+		select {
+		case <-quit:
+			q.stop(results)
+			return
+		case res := <-results:
+			q.finish(res)
+		case <-wake:
+		case <-tick.C:
+		}
+	}
+}
+
+// stop 取消进行中的任务并等待它们结束，这些任务重新排队
+func (q *Queue) stop(results <-chan jobResult) {
+	q.mu.Lock()
+	q.stopping = true
+	n := len(q.running)
+	for _, sender := range q.running {
+		sender.Cancel()
+	}
+	q.mu.Unlock()
+	for range n {
+		q.finish(<-results)
+	}
+	q.mu.Lock()
+	q.stopping = false
+	q.mu.Unlock()
+}
+
+// startReady 按优先级开始可执行的任务，直到达到并发上限。
+// 不在时间窗口内的任务记录下次窗口开始的时间。
+func (q *Queue) startReady(now time.Time, results chan<- jobResult) {
+	q.mu.Lock()
+	var ready, waiting []*Job
+	for _, j := range q.jobs {
+		if j.State != JobQueued || now.Before(j.NextRun) {
+			continue
+		}
+		if next := j.Window.next(now); next.After(now) {
+			if !next.Equal(j.NextRun) {
+				j.NextRun = next
+				waiting = append(waiting, j)
+			}
+			continue
+		}
+		ready = append(ready, j)
+	}
+	// 稳定排序保持相同优先级的队列顺序
+	sort.SliceStable(ready, func(a, b int) bool { return ready[a].Priority > ready[b].Priority })
+	free := max(q.Concurrency, 1) - len(q.running)
+	if len(ready) > free {
+		ready = ready[:max(free, 0)]
+	}
+
+	started := make([]Job, 0, len(ready)+len(waiting))
+	for _, j := range waiting {
+		started = append(started, *j)
+	}
+	for _, j := range ready {
+		if sender := q.start(j, results); sender != nil {
+			q.running[j.ID] = sender
+		}
+		started = append(started, *j)
+	}
+	if len(started) > 0 {
+		q.save()
+	}
+	q.mu.Unlock()
+
+	if q.Observer != nil {
+		for _, job := range started {
+			q.Observer.JobUpdated(job)
+		}
+	}
+}
+
+// start 开始一次尝试，调用时须持有 mu。选项无效时任务直接失败并返回 nil。
+func (q *Queue) start(j *Job, results chan<- jobResult) *Sender {
+	filter, err := NewFilter(j.Options)
+	if err != nil {
+		j.State = JobFailed
+		j.LastError = err.Error()
+		j.Finished = time.Now()
+		return nil
+	}
+	j.State = JobRunning
+	j.Attempts++
+	j.NextRun = time.Time{}
+	j.Stats = Stats{Status: "transferring"}
+
+	sender := &Sender{
+		Filter:   filter,
+		Observer: jobObserver{q: q, id: j.ID},
+		Limiters: q.Limiters,
+		Delta:    j.Options.Delta,
+		Dedup:    j.Options.Dedup,
+		Archive:  j.Options.Archive,
+	}
+	paths, target, id := j.Paths, j.Target, j.ID
+	go func() {
+		err := sender.Send(paths, target)
+		results <- jobResult{id: id, err: err}
+	}()
+	return sender
+}
+
+// finish 根据一次尝试的结果更新任务，失败时安排重试或将任务标记为失败
+func (q *Queue) finish(res jobResult) {
+	q.mu.Lock()
+	delete(q.running, res.id)
+	j, _ := q.find(res.id)
+	if j == nil || j.State != JobRunning {
+		// 已被移除或取消
+		q.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case res.err == nil:
+		j.State = JobCompleted
+		j.LastError = ""
+		j.Finished = now
+	case q.stopping && errors.Is(res.err, ErrCanceled):
+		// 退出时被中止的尝试不计入次数
+		j.State = JobQueued
+		j.Attempts--
+	default:
+		j.LastError = res.err.Error()
+		retries := j.Retries
+		if retries == 0 {
+			retries = DefaultQueueRetries
+		}
+		if j.Attempts > retries {
+			j.State = JobFailed
+			j.Finished = now
+			break
+		}
+		j.State = JobQueued
+		j.NextRun = now.Add(queueRetryDelay(j.Attempts))
+	}
+	q.pruneFinished()
+	q.save()
+	q.updated(j)
+}
+
+// queueRetryDelay 返回第 attempts 次尝试失败后的等待时间
+func queueRetryDelay(attempts int) time.Duration {
+	delay := queueRetryMin
+	for i := 1; i < attempts && delay < queueRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, queueRetryMax)
+}
+
+// pruneFinished 已结束的任务超过 queueFinishedLimit 时移除最早结束的，调用时须持有 mu
+func (q *Queue) pruneFinished() {
+	var finished []*Job
+	for _, j := range q.jobs {
+		if j.finished() {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= queueFinishedLimit {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].Finished.Before(finished[b].Finished) })
+	old := finished[:len(finished)-queueFinishedLimit]
+	q.jobs = slices.DeleteFunc(q.jobs, func(j *Job) bool { return slices.Contains(old, j) })
+}
+
+// jobObserver 将一次尝试的进度并入任务
+type jobObserver struct {
+	q  *Queue
+	id int
+}
+
+func (o jobObserver) StatusChanged(status string) {}
+
+func (o jobObserver) StatsUpdated(stats Stats) {
+	o.q.mu.Lock()
+	j, _ := o.q.find(o.id)
+	if j == nil || j.State != JobRunning {
+		o.q.mu.Unlock()
+		return
+	}
+	j.Stats = stats
+	o.q.updated(j)
+}
+
+// --------------------------- 时间窗口 ---------------------------
+// parseClock 将 "HH:MM" 解析为当天的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间: %q，应为 HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w TimeWindow) validate() error {
+	if w.Start == "" && w.End == "" {
+		return nil
+	}
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	_, err := parseClock(w.End)
+	return err
+}
+
+// next 返回 now 之后最早允许开始的时间，now 在时间窗口内时返回 now
+func (w TimeWindow) next(now time.Time) time.Time {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil || start == end {
+		return now
+	}
+	cur := now.Hour()*60 + now.Minute()
+	in := cur >= start && cur < end
+	if start > end {
+		in = cur >= start || cur < end
+	}
+	if in {
+		return now
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), start/60, start%60, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,135 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueueRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, queueRetryMin},
+		{1, queueRetryMin},
+		{2, 2 * queueRetryMin},
+		{3, 4 * queueRetryMin},
+		{6, 32 * queueRetryMin},
+		{7, queueRetryMax},
+		{100, queueRetryMax},
+	}
+	for _, tt := range tests {
+		if got := queueRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("queueRetryDelay(%d) = %v，应为 %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestTimeWindowNext(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.Local)
+	}
+	night := TimeWindow{Start: "22:00", End: "06:00"}
+	day := TimeWindow{Start: "09:00", End: "17:30"}
+	tests := []struct {
+		name string
+		w    TimeWindow
+		now  time.Time
+		want time.Time
+	}{
+		{"不限制", TimeWindow{}, at(10, 12, 0), at(10, 12, 0)},
+		{"开始与结束相同", TimeWindow{Start: "08:00", End: "08:00"}, at(10, 3, 0), at(10, 3, 0)},
+		{"白天窗口内", day, at(10, 9, 0), at(10, 9, 0)},
+		{"白天窗口前", day, at(10, 8, 59), at(10, 9, 0)},
+		{"白天窗口后", day, at(10, 17, 30), at(11, 9, 0)},
+		{"跨午夜窗口的前半段", night, at(10, 23, 15), at(10, 23, 15)},
+		{"跨午夜窗口的后半段", night, at(11, 5, 59), at(11, 5, 59)},
+		{"跨午夜窗口结束时", night, at(11, 6, 0), at(11, 22, 0)},
+		{"跨午夜窗口之间", night, at(11, 21, 59), at(11, 22, 0)},
+		{"跨月", night, time.Date(2024, 3, 31, 12, 0, 0, 0, time.Local), time.Date(2024, 3, 31, 22, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		if got := tt.w.next(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: next(%v) = %v，应为 %v", tt.name, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestTimeWindowValidate(t *testing.T) {
+	for _, w := range []TimeWindow{{}, {Start: "22:00", End: "06:00"}} {
+		if err := w.validate(); err != nil {
+			t.Errorf("%+v: %v", w, err)
+		}
+	}
+	for _, w := range []TimeWindow{{Start: "22:00"}, {Start: "25:00", End: "06:00"}, {Start: "8", End: "9"}} {
+		if err := w.validate(); err == nil {
+			t.Errorf("%+v 应无效", w)
+		}
+	}
+}
+
+// 重新读取队列文件时保留任务和编号，上次进行中的任务重新排队
+func TestQueueReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.json")
+	q := &Queue{QueueFile: file}
+	first, err := q.Add(Job{Paths: []string{"a.txt"}, Target: "10.0.0.2", Priority: 2, Window: TimeWindow{Start: "22:00", End: "06:00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Add(Job{Paths: []string{"b.txt"}, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Cancel(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟退出时仍在进行的任务
+	q.mu.Lock()
+	j, _ := q.find(first.ID)
+	j.State = JobRunning
+	j.Attempts = 1
+	q.save()
+	q.mu.Unlock()
+
+	reloaded := &Queue{QueueFile: file}
+	jobs := reloaded.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("重新读取到 %d 个任务", len(jobs))
+	}
+	got := jobs[0]
+	if got.ID != first.ID || got.State != JobQueued || got.Attempts != 1 || got.Target != "10.0.0.2" ||
+		got.Priority != 2 || got.Window != first.Window || len(got.Paths) != 1 || got.Paths[0] != "a.txt" {
+		t.Errorf("进行中的任务 = %+v", got)
+	}
+	if jobs[1].ID != second.ID || jobs[1].State != JobCanceled || jobs[1].Retries != -1 {
+		t.Errorf("已取消的任务 = %+v", jobs[1])
+	}
+
+	// 编号不与已移除的任务重复
+	if err := reloaded.Remove(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	third, err := (&Queue{QueueFile: file}).Add(Job{Paths: []string{"c.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID <= second.ID {
+		t.Errorf("新任务编号 %d 与之前的任务重复", third.ID)
+	}
+}
+
+func TestQueueReloadCorruptFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.json")
+	if err := os.WriteFile(file, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := &Queue{QueueFile: file}
+	if jobs := q.Jobs(); len(jobs) != 0 {
+		t.Fatalf("损坏的队列文件读取到 %d 个任务", len(jobs))
+	}
+	if job, err := q.Add(Job{Paths: []string{"a.txt"}}); err != nil || job.ID != 1 {
+		t.Fatalf("Add = %+v, %v", job, err)
+	}
+}
@@ -0,0 +1,197 @@
+package transfer
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// --------------------------- 限速配置 ---------------------------
+const (
+	rateLimitPieceSize = 64 * 1024       // 每次申请令牌的最大字节数
+	rateLimitMinBurst  = 256 * 1024      // 令牌桶最小容量
+	rateLimitChunkSize = 1024 * 1024     // 限速时的进度更新粒度
+	throttleHoldTime   = 1 * time.Second // 最近一次等待后仍视为"限速中"的时间
+)
+
+// --------------------------- 令牌桶 ---------------------------
+// RateLimiter 为按字节计量的令牌桶，rate 为 0 表示不限速。速率可在传输过程中随时调整。
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // 字节/秒
+	tokens      float64
+	last        time.Time
+	throttledAt time.Time
+}
+
+// NewRateLimiter 创建速率为 mbps (MB/s) 的令牌桶，0 表示不限速
+func NewRateLimiter(mbps float64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(mbps)
+	return l
+}
+
+// SetRate 设置速率 (MB/s)，0 或负数表示不限速
+func (l *RateLimiter) SetRate(mbps float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if mbps < 0 {
+		mbps = 0
+	}
+	l.rate = mbps * 1024 * 1024
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// Rate 返回当前速率 (MB/s)
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate / (1024 * 1024)
+}
+
+func (l *RateLimiter) active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate > 0
+}
+
+// throttled 报告最近是否因限速发生过等待
+func (l *RateLimiter) throttled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate > 0 && time.Since(l.throttledAt) < throttleHoldTime
+}
+
+// wait 申请 n 个令牌，不足时阻塞到令牌补足
+func (l *RateLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	burst := l.rate / 10
+	if burst < rateLimitMinBurst {
+		burst = rateLimitMinBurst
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.throttledAt = now
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// --------------------------- 限速读写包装 ---------------------------
+// rateLimitedWriter 在写入前依次向所有令牌桶申请令牌
+type rateLimitedWriter struct {
+	w        io.Writer
+	limiters []*RateLimiter
+}
+
+func (rw *rateLimitedWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		n := len(p)
+		if n > rateLimitPieceSize {
+			n = rateLimitPieceSize
+		}
+		for _, l := range rw.limiters {
+			l.wait(n)
+		}
+		written, err := rw.w.Write(p[:n])
+		total += written
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (rw *rateLimitedWriter) active() bool {
+	for _, l := range rw.limiters {
+		if l.active() {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitedReader 在读取后依次向所有令牌桶申请令牌
+type rateLimitedReader struct {
+	r        io.Reader
+	limiters []*RateLimiter
+}
+
+func (rr *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitPieceSize {
+		p = p[:rateLimitPieceSize]
+	}
+	n, err := rr.r.Read(p)
+	if n > 0 {
+		for _, l := range rr.limiters {
+			l.wait(n)
+		}
+	}
+	return n, err
+}
+
+func (rr *rateLimitedReader) active() bool {
+	for _, l := range rr.limiters {
+		if l.active() {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapIdleLimits 在未启用任何限速时剥掉包装层，使该块数据仍可走 sendfile/splice。
+// limited 报告该块是否仍受限速约束。
+func unwrapIdleLimits(dst io.Writer, src io.Reader) (io.Writer, io.Reader, bool) {
+	limited := false
+	if rw, ok := dst.(*rateLimitedWriter); ok {
+		if rw.active() {
+			limited = true
+		} else {
+			dst = rw.w
+		}
+	}
+	if rr, ok := src.(*rateLimitedReader); ok {
+		if rr.active() {
+			limited = true
+			// 屏蔽 dst 的 ReadFrom，让限速读取走共享缓冲区
+			dst = struct{ io.Writer }{dst}
+		} else {
+			src = rr.r
+		}
+	}
+	return dst, src, limited
+}
+
+// effectiveRateLimit 返回各令牌桶中最严格的限速 (MB/s)，以及是否有令牌桶正在限速
+func effectiveRateLimit(limiters []*RateLimiter) (float64, bool) {
+	var limit float64
+	throttled := false
+	for _, l := range limiters {
+		if r := l.Rate(); r > 0 && (limit == 0 || r < limit) {
+			limit = r
+		}
+		throttled = throttled || l.throttled()
+	}
+	return limit, throttled
+}
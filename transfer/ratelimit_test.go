@@ -0,0 +1,75 @@
+package transfer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// 持续写入的平均速度不超过设定的速率
+func TestRateLimiterRate(t *testing.T) {
+	l := NewRateLimiter(4)
+	var buf bytes.Buffer
+	w := &rateLimitedWriter{w: &buf, limiters: []*RateLimiter{l}}
+
+	start := time.Now()
+	n, err := w.Write(make([]byte, 2<<20))
+	elapsed := time.Since(start)
+	if err != nil || n != 2<<20 || buf.Len() != 2<<20 {
+		t.Fatalf("写入 %d 字节: %v", n, err)
+	}
+	// 2MB 以 4MB/s 发送约需 0.5 秒
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("耗时 %v，应约为 500ms", elapsed)
+	}
+	if !l.throttled() {
+		t.Error("等待过令牌后应报告限速中")
+	}
+}
+
+// 空闲期间积累的令牌不超过桶容量
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(4)
+	burst := int(4 * 1024 * 1024 / 10)
+	time.Sleep(200 * time.Millisecond) // 足以积累两倍容量的令牌
+
+	start := time.Now()
+	l.wait(burst)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("桶容量内的突发等待了 %v", elapsed)
+	}
+	start = time.Now()
+	l.wait(burst)
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("超出桶容量的部分只等待了 %v，应约为 100ms", elapsed)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(0)
+	start := time.Now()
+	for range 100 {
+		l.wait(rateLimitPieceSize)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("不限速时等待了 %v", elapsed)
+	}
+	if l.throttled() {
+		t.Error("不限速时不应报告限速中")
+	}
+
+	l.SetRate(-1)
+	if l.Rate() != 0 || l.active() {
+		t.Errorf("负数速率应视为不限速: %v", l.Rate())
+	}
+}
+
+func TestEffectiveRateLimit(t *testing.T) {
+	limit, throttled := effectiveRateLimit([]*RateLimiter{NewRateLimiter(0), NewRateLimiter(8), NewRateLimiter(2)})
+	if limit != 2 || throttled {
+		t.Errorf("effectiveRateLimit = %v, %v，应为 2, false", limit, throttled)
+	}
+	if limit, _ := effectiveRateLimit(nil); limit != 0 {
+		t.Errorf("无令牌桶时 = %v", limit)
+	}
+}
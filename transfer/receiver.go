@@ -0,0 +1,487 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 接收端 ---------------------------
+// Receiver 监听传输端口并接收一次会话，或通过 Pull 从共享端拉取。同一个 Receiver 不能并发调用 Receive 或 Pull。
+type Receiver struct {
+	Dir              string         // 保存目录，为空时使用当前目录
+	PreserveMetadata bool           // 是否恢复修改时间和权限
+	FreeSpaceMargin  int64          // 接收后应保留的最小剩余空间（字节），0 表示不检查
+	Observer         Observer       // 进度与状态观察者，可为 nil
+	Limiters         []*RateLimiter // 接收时依次申请令牌的令牌桶，如全局与会话限速
+	Hooks            Hooks          // 接收完成后执行的命令
+	TextObserver     TextObserver   // 收到文本消息时通知，可为 nil
+	ExtractArchives  bool           // 收到归档流时边接收边解压到保存目录，否则按原样保存归档文件
+	AllowSync        bool           // 是否响应对方发起的文件夹同步，同步会修改和删除保存目录下同名文件夹中的文件
+	Output           io.Writer      // 不为 nil 时只接受单个文件，内容写入 Output 而不保存到 Dir，也不执行文件钩子
+
+	sess     *session
+	hooks    *hookRunner
+	record   Record
+	pulling  bool // 由 Pull 发起，只接受文件、目录和链接条目
+	mu       sync.Mutex
+	closers  []io.Closer // 监听器和当前连接，取消时关闭
+	canceled bool
+}
+
+// Cancel 停止等待或中止进行中的接收，Receive 随后返回 ErrCanceled。取消后的 Receiver 不能再次使用。
+func (r *Receiver) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canceled = true
+	for _, c := range r.closers {
+		c.Close()
+	}
+}
+
+// Record 返回最近一次 Receive 的会话摘要和钩子执行结果，发送端未连接时为零值
+func (r *Receiver) Record() Record {
+	return r.record
+}
+
+// attach 记录监听器或连接以便取消，已取消时返回 ErrCanceled
+func (r *Receiver) attach(c io.Closer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.canceled {
+		return ErrCanceled
+	}
+	r.closers = append(r.closers, c)
+	return nil
+}
+
+func (r *Receiver) isCanceled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.canceled
+}
+
+// Receive 等待发送端连接并接收一次会话，阻塞到传输结束。
+// 等待期间应答发现请求，使发送端可以自动找到本机。
+func (r *Receiver) Receive() (err error) {
+	r.sess = newSession(r.Observer, r.Limiters)
+	r.pulling = false
+	defer func() {
+		if err != nil && r.isCanceled() {
+			err = ErrCanceled
+		}
+		if err != nil {
+			r.sess.fail(err)
+		}
+	}()
+
+	localIP, err := LocalIP()
+	if err != nil {
+		return fmt.Errorf("获取本地IP失败: %v", err)
+	}
+
+	destDir := r.Dir
+	if destDir == "" {
+		destDir = "."
+	}
+
+	r.sess.update(func(st *Stats) { st.Status = "waiting" })
+
+	r.sess.status("正在等待连接...")
+
+	quit := make(chan struct{})
+	go (&Discoverer{}).Serve(quit)
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", localIP, DefaultPort))
+	if err != nil {
+		close(quit)
+		return fmt.Errorf("监听端口失败: %v", err)
+	}
+	defer ln.Close()
+	if err = r.attach(ln); err != nil {
+		close(quit)
+		return err
+	}
+
+	// 设置超时，避免无限等待
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(TimeoutDuration * 5))
+
+	r.sess.status("等待发送方连接...")
+
+	conn, err := ln.Accept()
+	close(quit)
+	if err != nil {
+		return fmt.Errorf("接受连接失败: %v", err)
+	}
+	defer conn.Close()
+	if err = r.attach(conn); err != nil {
+		return err
+	}
+
+	r.sess.status("已连接到发送方，开始接收...")
+	return r.serve(conn, destDir)
+}
+
+// serve 接收已建立连接上的一次会话，结束后执行会话钩子并记录摘要
+func (r *Receiver) serve(conn net.Conn, destDir string) error {
+	started := time.Now()
+	peer, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	r.hooks = newHookRunner(r.Hooks, peer, destDir)
+	err := r.receive(conn, destDir)
+	if err != nil && r.isCanceled() {
+		err = ErrCanceled
+	}
+	r.record = r.hooks.finish(started, err)
+	if r.record.HooksFailed > 0 {
+		r.sess.status(fmt.Sprintf("%d 个钩子执行失败", r.record.HooksFailed))
+	}
+	return err
+}
+
+// receive 从已建立的连接读取清单、统计信息和各条目
+func (r *Receiver) receive(conn net.Conn, destDir string) error {
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration))
+	reader := bufio.NewReader(conn)
+	if r.pulling {
+		// 拉取时对方是共享端，只接收所请求的文件，不响应同步和文本消息
+		return r.receiveEntries(conn, reader, destDir)
+	}
+	if head, err := reader.Peek(len(SyncMarker) + 1); err == nil && string(head) == SyncMarker+"|" {
+		if r.Output != nil {
+			return fmt.Errorf("接收端只接受单个文件，不支持同步")
+		}
+		return r.serveSync(conn, reader, destDir)
+	}
+	if isTextRequest(reader) {
+		return r.receiveText(conn, reader)
+	}
+	return r.receiveEntries(conn, reader, destDir)
+}
+
+// receiveEntries 读取清单、统计信息和各条目
+func (r *Receiver) receiveEntries(conn net.Conn, reader *bufio.Reader, destDir string) error {
+	roots, err := readManifest(reader)
+	if err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// 先清理本次各发送根上次中断遗留的临时文件，写入 Output 时不涉及保存目录
+	if r.Output == nil {
+		if removed := cleanupPartials(destDir, roots); removed > 0 {
+			r.sess.status(fmt.Sprintf("已清理 %d 个未完成的临时文件", removed))
+		}
+	}
+
+	// 各发送根并列保存在保存目录下
+	for _, root := range roots {
+		if !root.IsDir || r.Output != nil {
+			continue
+		}
+		rootPath, err := confinedJoin(destDir, root.Name)
+		if err != nil {
+			return err
+		}
+		os.MkdirAll(rootPath, 0755)
+	}
+
+	// 接收统计信息
+	statsData, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("读取统计信息失败: %v", err)
+	}
+	statsParts := strings.Split(strings.TrimSpace(statsData), "|")
+	if (len(statsParts) == 3 || len(statsParts) == 4) && statsParts[0] == StatsMarker {
+		// 使用发送方提供的统计信息初始化接收方统计
+		totalFiles, _ := strconv.Atoi(statsParts[1])
+		totalBytes, _ := strconv.ParseInt(statsParts[2], 10, 64)
+		// 第四个字段为稀疏文件只计数据段后实际需要的磁盘空间
+		diskBytes := totalBytes
+		if len(statsParts) == 4 {
+			if n, err := strconv.ParseInt(statsParts[3], 10, 64); err == nil && n >= 0 && n < totalBytes {
+				diskBytes = n
+			}
+		}
+
+		// 检查保存目录的可用空间，不足时告知发送方拒绝原因；写入 Output 时只检查是否为单个文件
+		reject, warning := outputReject(roots), ""
+		if r.Output == nil {
+			reject, warning = checkDiskSpace(destDir, diskBytes, r.FreeSpaceMargin)
+		}
+		if reject != "" {
+			conn.Write([]byte(fmt.Sprintf("%s|%s\n", RejectMarker, reject)))
+			return fmt.Errorf("已拒绝传输: %s", reject)
+		}
+		if warning != "" {
+			r.sess.status("警告: " + warning)
+		}
+		// 差异传输和去重依赖保存目录中的文件，写入 Output 时不声明
+		// 拉取时不声明任何扩展，共享端只按普通文件发送
+		caps := []string{AcceptMarker, StreamCapability, ArchiveCapability}
+		if r.pulling {
+			caps = caps[:1]
+		} else if r.Output == nil {
+			caps = append(caps, DeltaCapability, DedupCapability)
+		}
+		conn.Write([]byte(strings.Join(caps, "|") + "\n"))
+
+		r.sess.update(func(st *Stats) {
+			st.TotalFiles = totalFiles
+			st.TotalBytes = totalBytes
+			st.Progress = 0.1 // 设置初始进度为0.1%，避免显示0%
+			st.Status = "transferring"
+		})
+	} else {
+		// 向后兼容：如果没有收到统计信息，使用默认值
+		r.sess.update(func(st *Stats) {
+			st.TotalFiles = 1
+			st.TotalBytes = 1
+			st.Progress = 0.1 // 设置初始进度为0.1%，避免显示0%
+			st.Status = "transferring"
+		})
+	}
+
+	if r.Output != nil {
+		return r.receiveOutput(conn, reader)
+	}
+
+	startTime := time.Now()
+	var receivedBytes int64
+	var completedFiles int
+	// 目录属性需在其内容写完后恢复
+	type receivedDir struct {
+		path string
+		hdr  entryHeader
+	}
+	var receivedDirs []receivedDir
+	// 本次已接收的文件（相对路径 → 保存路径），供去重的副本查找原文件
+	receivedFiles := make(map[string]string)
+	var recvErr error
+
+	// fileDone 记录一个已接收的文件，排队执行文件钩子并更新统计
+	fileDone := func(targetPath, relPath string, size int64) {
+		completedFiles++
+		r.hooks.fileDone(targetPath, relPath, size)
+
+		// 更新统计信息 - 接收端动态调整总数
+		r.sess.update(func(st *Stats) {
+			st.CompletedFiles = completedFiles
+			st.TransferredBytes = receivedBytes
+			// 动态调整总文件数，使用已完成的文件数作为参考
+			if completedFiles > st.TotalFiles {
+				st.TotalFiles = completedFiles
+			}
+			// 动态调整总字节数，使用已接收的字节数作为参考
+			if receivedBytes > st.TotalBytes {
+				st.TotalBytes = receivedBytes
+			}
+		})
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				recvErr = fmt.Errorf("连接在传输结束前关闭")
+				break
+			}
+			recvErr = fmt.Errorf("读取文件头失败: %v", err)
+			break
+		}
+		line = strings.TrimSpace(line)
+		if line == EndMarker {
+			r.sess.status("传输完成")
+			break
+		}
+		hdr, err := parseEntryHeader(line)
+		if err != nil {
+			recvErr = err
+			break
+		}
+		// 稀疏文件头由发送端按文件内容自动选用，仍属于普通文件
+		if r.pulling && (hdr.IsArchive || hdr.IsStream || hdr.IsDelta || hdr.IsDup) {
+			recvErr = fmt.Errorf("拉取时不接受的条目: %s", hdr.RelPath)
+			break
+		}
+		relPath := hdr.RelPath
+		fileSize := hdr.Size
+		targetPath, err := confinedJoin(destDir, relPath)
+		if err != nil {
+			recvErr = err
+			break
+		}
+
+		if hdr.IsDir {
+			if err := os.MkdirAll(targetPath, 0755); err != nil {
+				recvErr = fmt.Errorf("创建目录失败: %v", err)
+				break
+			}
+			receivedDirs = append(receivedDirs, receivedDir{path: targetPath, hdr: hdr})
+			continue
+		}
+		if hdr.IsLink {
+			// 越界或无法创建的链接只跳过，不中断整个传输
+			if err := createConfinedSymlink(destDir, targetPath, hdr.LinkTarget); err != nil {
+				r.sess.status(err.Error())
+			}
+			continue
+		}
+		if hdr.IsArchive {
+			err := r.receiveArchive(hdr, reader, conn, destDir, func(written int64) {
+				receivedBytes += written
+				r.sess.progress(relPath, receivedBytes, startTime)
+			}, fileDone)
+			if err != nil {
+				recvErr = err
+				break
+			}
+			continue
+		}
+		os.MkdirAll(filepath.Dir(targetPath), 0755)
+
+		// 更新当前文件状态
+		r.sess.progress(relPath, receivedBytes, startTime)
+
+		// 稀疏文件先读取数据段列表，普通文件视为一个完整数据段
+		extents := []extent{{Offset: 0, Length: fileSize}}
+		if hdr.IsSparse {
+			if extents, err = readExtents(reader, hdr.ExtentCount, fileSize); err != nil {
+				recvErr = err
+				break
+			}
+		}
+		// 去重的副本从本次已接收的原文件复制，无需预分配
+		var dupSource string
+		if hdr.IsDup {
+			if dupSource = receivedFiles[hdr.DupSource]; dupSource == "" {
+				recvErr = fmt.Errorf("去重的原文件未接收: %s", hdr.DupSource)
+				break
+			}
+			extents = nil
+		}
+
+		// 先写入隐藏的临时文件，完成后再重命名
+		partialPath := partialPathFor(targetPath)
+		file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			recvErr = fmt.Errorf("创建文件失败: %v", err)
+			break
+		}
+
+		// 流式文件大小未知，不预分配
+		if hdr.IsStream {
+			extents = nil
+		}
+
+		// 预分配磁盘空间，空间不足时在写入前失败
+		fileWriteError := allocateExtents(file, fileSize, extents)
+
+		// 接收文件内容并实时更新进度（Linux 上由 splice 完成）
+		var dataBytes int64
+		if hdr.IsDelta && fileWriteError == nil {
+			// 差异文件以已有的同名文件为基础重建，复用的块计入进度但不占传输量
+			var literal int64
+			literal, fileWriteError = r.receiveDelta(file, reader, conn, targetPath, fileSize, func(written int64) {
+				receivedBytes += written
+				r.sess.progress(relPath, receivedBytes, startTime)
+			})
+			dataBytes = fileSize
+			if fileWriteError == nil {
+				r.sess.update(func(st *Stats) { st.SavedBytes += fileSize - literal })
+			}
+			extents = nil
+		}
+		if hdr.IsStream && fileWriteError == nil {
+			// 流式文件读完数据块后才知道实际大小
+			fileSize, fileWriteError = r.receiveStream(file, reader, conn, func(written int64) {
+				receivedBytes += written
+				r.sess.progress(relPath, receivedBytes, startTime)
+			})
+			dataBytes = fileSize
+		}
+		if hdr.IsDup && fileWriteError == nil {
+			// 副本不占传输量，由下方按空洞计入进度
+			fileWriteError = copyDuplicate(file, dupSource)
+			if fileWriteError == nil {
+				r.sess.update(func(st *Stats) { st.SavedBytes += fileSize })
+			}
+		}
+		for _, e := range extents {
+			if fileWriteError != nil {
+				break
+			}
+			if _, fileWriteError = file.Seek(e.Offset, io.SeekStart); fileWriteError != nil {
+				break
+			}
+			_, fileWriteError = receiveFileContent(file, reader, conn, r.sess.throttledReader(conn), e.Length, func(written int64) {
+				receivedBytes += written
+				r.sess.progress(relPath, receivedBytes, startTime)
+			})
+			dataBytes += e.Length
+		}
+		if fileWriteError == nil {
+			// 空洞不占传输量，但计入进度
+			receivedBytes += fileSize - dataBytes
+		}
+
+		// 校验大小并落盘后重命名为最终文件名，同时确保文件正确关闭
+		if fileWriteError == nil {
+			fileWriteError = commitPartial(file, partialPath, targetPath, fileSize)
+		} else {
+			// 写入已失败，临时文件随后删除，关闭错误无需另行报告
+			file.Close()
+		}
+
+		// 如果文件写入失败，删除不完整的临时文件，已存在的同名文件保持不变
+		if fileWriteError != nil {
+			os.Remove(partialPath)
+			recvErr = fmt.Errorf("写入文件失败: %v", fileWriteError)
+			break
+		}
+
+		if r.PreserveMetadata {
+			if err := applyMetadata(targetPath, hdr); err != nil {
+				r.sess.warn(err.Error())
+			}
+		}
+
+		receivedFiles[relPath] = targetPath
+		if hdr.IsDup {
+			r.hooks.duplicate(Duplicate{Path: relPath, Source: hdr.DupSource})
+		}
+		fileDone(targetPath, relPath, fileSize)
+	}
+
+	// 倒序恢复目录属性，保证子目录先于父目录处理
+	if r.PreserveMetadata {
+		for i := len(receivedDirs) - 1; i >= 0; i-- {
+			if err := applyMetadata(receivedDirs[i].path, receivedDirs[i].hdr); err != nil {
+				r.sess.warn(err.Error())
+			}
+		}
+	}
+
+	if recvErr != nil {
+		return recvErr
+	}
+
+	// 传输完成
+	r.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+		st.CompletedFiles = completedFiles
+		st.TransferredBytes = receivedBytes
+		st.TotalFiles = completedFiles
+		st.TotalBytes = receivedBytes
+	})
+
+	r.sess.status("文件接收完成")
+	return nil
+}
@@ -0,0 +1,352 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// --------------------------- 发送端 ---------------------------
+// Sender 将本地文件和文件夹发送到接收端。同一个 Sender 不能并发调用 Send。
+type Sender struct {
+	Filter   *Filter        // 过滤规则，nil 表示不过滤且跟随符号链接
+	Observer Observer       // 进度与状态观察者，可为 nil
+	Limiters []*RateLimiter // 发送时依次申请令牌的令牌桶，如全局与会话限速
+	Delta    bool           // 接收端支持时，较大的文件只发送与接收端已有同名文件的差异
+	Dedup    bool           // 接收端支持时，内容重复的文件只发送一次
+	Archive  string         // 不为空时将所有根即时打包为该格式的归档流发送: tar, tar.gz, zip
+
+	TargetObserver TargetObserver // SendToMany 时接收各接收端的进度，可为 nil
+	FanOutBuffer   int64          // SendToMany 时每个接收端可落后的字节数，0 使用 DefaultFanOutBuffer
+
+	sess     *session
+	delta    bool              // 本次连接是否使用差异传输
+	dups     map[string]string // 本次连接去重的文件: 相对路径 → 原文件相对路径
+	reader   *bufio.Reader     // 读取接收端答复的块签名
+	mu       sync.Mutex
+	conns    []net.Conn // 当前会话的连接，一对多发送时有多个
+	canceled bool
+}
+
+// Cancel 中止进行中的发送，Send 随后返回 ErrCanceled。取消后的 Sender 不能再次使用。
+func (s *Sender) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.canceled = true
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+// attach 记录当前连接以便取消，已取消时返回 ErrCanceled
+func (s *Sender) attach(conn net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canceled {
+		return ErrCanceled
+	}
+	s.conns = append(s.conns, conn)
+	return nil
+}
+
+func (s *Sender) isCanceled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.canceled
+}
+
+// Send 在一次会话中发送 paths 中的文件和文件夹，阻塞到传输结束。
+// target 为接收端地址，为空时通过广播自动发现。
+func (s *Sender) Send(paths []string, target string) error {
+	s.sess = newSession(s.Observer, s.Limiters)
+	s.sess.status("正在扫描文件...")
+
+	roots, err := buildSendRoots(paths)
+	if err != nil {
+		s.sess.status(err.Error())
+		return err
+	}
+
+	if target == "" {
+		if target, err = (&Discoverer{}).FindFirst(); err != nil {
+			err = fmt.Errorf("发现接收端失败: %v", err)
+			s.sess.status(err.Error())
+			return err
+		}
+	}
+
+	s.sess.status("已连接到接收端: " + target)
+	s.sess.status("正在传输文件...")
+	return s.send(roots, target)
+}
+
+// --------------------------- 文件扫描和统计工具 ---------------------------
+// ScanFiles 按过滤规则统计 path 下的文件数和总字节数
+func ScanFiles(path string, filter *Filter) (int, int64, error) {
+	totalFiles, totalBytes, _, err := scanFiles(path, filter, false)
+	return totalFiles, totalBytes, err
+}
+
+// scanFiles 与 ScanFiles 相同，countDisk 为 true 时还统计接收端需要的磁盘空间，稀疏文件只计数据段
+func scanFiles(path string, filter *Filter, countDisk bool) (int, int64, int64, error) {
+	var totalFiles int
+	var totalBytes, diskBytes int64
+
+	err := filter.walk(path, "", func(fullPath, rel string, info os.FileInfo) error {
+		if info.IsDir() || isSymlink(info) {
+			return nil
+		}
+		totalFiles++
+		totalBytes += info.Size()
+		if countDisk {
+			diskBytes += diskUsage(fullPath, info)
+		}
+		return nil
+	})
+
+	return totalFiles, totalBytes, diskBytes, err
+}
+
+// formatStats 生成统计信息行 STATS_INFO|文件数|字节数[|磁盘字节数]。
+// 稀疏文件使接收端实际写入的字节数少于总字节数时附带第四个字段，供接收端检查剩余空间；
+// 旧版接收端不识别四个字段，此时只是不显示总量，传输不受影响。
+func formatStats(files int, bytes, diskBytes int64) string {
+	if diskBytes < bytes {
+		return fmt.Sprintf("%s|%d|%d|%d\n", StatsMarker, files, bytes, diskBytes)
+	}
+	return fmt.Sprintf("%s|%d|%d\n", StatsMarker, files, bytes)
+}
+
+// --------------------------- 发送逻辑 ---------------------------
+func (s *Sender) sendFile(conn net.Conn, fullPath, rel string, fi os.FileInfo, startTime time.Time, transferredBytes *int64) error {
+	if source, ok := s.dups[rel]; ok {
+		return s.sendDuplicate(conn, rel, fi, source, startTime, transferredBytes)
+	}
+
+	// 更新当前文件状态
+	s.sess.progress(rel, *transferredBytes, startTime)
+
+	// 使用defer确保文件句柄正确关闭
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Errorf("打开文件失败 %s: %v", fullPath, err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			s.sess.warn(fmt.Sprintf("关闭文件失败 %s: %v", fullPath, closeErr))
+		}
+	}()
+
+	// 发送文件头（携带权限和修改时间），稀疏文件附带数据段列表
+	extents := sparseExtents(f, fi.Size())
+	hdr := formatFileHeader(rel, fi)
+	useDelta := s.delta && extents == nil && fi.Size() >= deltaMinSize
+	if extents != nil {
+		hdr = formatSparseHeader(rel, fi, extents)
+	} else if useDelta {
+		hdr = formatDeltaHeader(rel, fi)
+	}
+	// 设置写入超时，避免网络阻塞
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err = conn.Write([]byte(hdr)); err != nil {
+		return fmt.Errorf("发送文件头失败 %s: %v", rel, err)
+	}
+	// 重置写入超时
+	conn.SetWriteDeadline(time.Time{})
+
+	// 发送文件内容并实时更新进度（纯 TCP 连接上由 sendfile 完成）
+	onChunk := func(written int64) {
+		*transferredBytes += written
+		s.sess.progress(rel, *transferredBytes, startTime)
+	}
+	if useDelta {
+		return s.sendDelta(conn, f, rel, fi, startTime, transferredBytes)
+	}
+	if extents == nil {
+		extents = []extent{{Offset: 0, Length: fi.Size()}}
+	}
+	var dataBytes int64
+	for _, e := range extents {
+		if _, err = f.Seek(e.Offset, io.SeekStart); err != nil {
+			return fmt.Errorf("读取文件失败 %s: %v", rel, err)
+		}
+		if _, err = sendFileContent(conn, s.sess.throttledWriter(conn), f, e.Length, onChunk); err != nil {
+			return fmt.Errorf("发送文件内容失败 %s: %v", rel, err)
+		}
+		dataBytes += e.Length
+	}
+	// 空洞不占传输量，但计入进度
+	*transferredBytes += fi.Size() - dataBytes
+
+	// 确保文件传输完成时更新统计
+	s.sess.mu.Lock()
+	s.sess.stats.CompletedFiles++
+	s.sess.mu.Unlock()
+	s.sess.progress("", *transferredBytes, startTime)
+
+	return nil
+}
+
+func (s *Sender) sendFileOrFolder(conn net.Conn, root sendRoot, startTime time.Time, transferredBytes *int64) error {
+	return s.Filter.walkWarn(root.Path, root.Name, s.sess.warn, func(fullPath, rel string, info os.FileInfo) error {
+		if info.IsDir() {
+			// 发送目录头，使空目录和目录属性也能在接收端恢复
+			conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+			defer conn.SetWriteDeadline(time.Time{})
+			if _, err := conn.Write([]byte(formatDirHeader(rel, info))); err != nil {
+				return fmt.Errorf("发送目录头失败 %s: %v", rel, err)
+			}
+			return nil
+		}
+		if isSymlink(info) {
+			// 发送链接头，由接收端重建符号链接
+			target, err := os.Readlink(fullPath)
+			if err != nil {
+				return fmt.Errorf("读取符号链接失败 %s: %v", fullPath, err)
+			}
+			conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+			defer conn.SetWriteDeadline(time.Time{})
+			if _, err := conn.Write([]byte(formatLinkHeader(rel, target))); err != nil {
+				return fmt.Errorf("发送链接头失败 %s: %v", rel, err)
+			}
+			return nil
+		}
+		return s.sendFile(conn, fullPath, rel, info, startTime, transferredBytes)
+	})
+}
+
+func (s *Sender) send(roots []sendRoot, targetIP string) error {
+	return s.sendOver(roots, func() (net.Conn, error) {
+		return dialReceiver(targetIP)
+	})
+}
+
+// dialReceiver 连接 targetIP 上接收端的传输端口
+func dialReceiver(targetIP string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", receiverAddr(targetIP), TimeoutDuration)
+	if err != nil {
+		return nil, fmt.Errorf("连接接收端失败: %v", err)
+	}
+	return conn, nil
+}
+
+// sendOver 扫描各根后通过 connect 取得连接并发送，主动发送和共享端响应拉取共用
+func (s *Sender) sendOver(roots []sendRoot, connect func() (net.Conn, error)) (err error) {
+	defer func() {
+		if err != nil && s.isCanceled() {
+			err = ErrCanceled
+		}
+		if err != nil {
+			s.sess.fail(err)
+		}
+	}()
+
+	if !validArchiveFormat(s.Archive) {
+		return fmt.Errorf("未知的归档格式: %s", s.Archive)
+	}
+
+	// 扫描文件获取总数和总大小
+	s.sess.update(func(st *Stats) { st.Status = "scanning" })
+
+	// 多个根时汇总所有根的文件数和大小；打包发送时没有稀疏文件，磁盘占用即总字节数
+	var totalFiles int
+	var totalBytes, diskBytes int64
+	for _, root := range roots {
+		files, bytes, disk, err := scanFiles(root.Path, s.Filter, s.Archive == "")
+		if err != nil {
+			return fmt.Errorf("扫描文件失败: %v", err)
+		}
+		totalFiles += files
+		totalBytes += bytes
+		diskBytes += disk
+	}
+	if s.Archive != "" {
+		diskBytes = totalBytes
+	}
+
+	// 启用去重时找出内容重复的文件，接收端不支持时在握手后放弃；打包发送时不去重
+	s.dups = nil
+	if s.Dedup && s.Archive == "" {
+		s.sess.status("正在查找重复文件...")
+		if s.dups, err = findDuplicates(roots, s.Filter); err != nil {
+			return fmt.Errorf("扫描文件失败: %v", err)
+		}
+	}
+
+	// 更新统计信息
+	s.sess.update(func(st *Stats) {
+		st.TotalFiles = totalFiles
+		st.TotalBytes = totalBytes
+		st.Status = "transferring"
+	})
+
+	conn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = s.attach(conn); err != nil {
+		return err
+	}
+
+	// 打包发送时清单中只有归档文件，统计信息仍为打包前的文件数和字节数
+	manifest := roots
+	if s.Archive != "" {
+		manifest = []sendRoot{{Name: archiveName(roots, s.Archive)}}
+	}
+	if err = writeManifest(conn, manifest); err != nil {
+		return fmt.Errorf("发送元数据失败: %v", err)
+	}
+
+	// 发送统计信息给接收方，确保接收方有正确的进度计算基础
+	if _, err = conn.Write([]byte(formatStats(totalFiles, totalBytes, diskBytes))); err != nil {
+		return fmt.Errorf("发送统计信息失败: %v", err)
+	}
+
+	// 等待接收端确认，被拒绝时（如磁盘空间不足）显示原因
+	reason, caps := waitForAccept(conn)
+	if reason != "" {
+		return fmt.Errorf("接收端拒绝传输: %s", reason)
+	}
+	if s.Archive != "" && !slices.Contains(caps, ArchiveCapability) {
+		return fmt.Errorf("接收端不支持归档传输，请升级接收端")
+	}
+	s.delta = s.Delta && s.Archive == "" && slices.Contains(caps, DeltaCapability)
+	if !slices.Contains(caps, DedupCapability) {
+		s.dups = nil
+	}
+	s.reader = bufio.NewReader(conn)
+
+	startTime := time.Now()
+	var transferredBytes int64
+
+	if s.Archive != "" {
+		if err = s.sendArchive(conn, roots, manifest[0].Name, startTime, &transferredBytes); err != nil {
+			return err
+		}
+	} else {
+		for _, root := range roots {
+			if err = s.sendFileOrFolder(conn, root, startTime, &transferredBytes); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err = conn.Write([]byte(EndMarker + "\n")); err != nil {
+		return fmt.Errorf("发送结束标记失败: %v", err)
+	}
+
+	// 传输完成
+	s.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+		st.CompletedFiles = st.TotalFiles
+		st.TransferredBytes = st.TotalBytes
+	})
+	return nil
+}
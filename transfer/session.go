@@ -0,0 +1,181 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// --------------------------- 性能优化结构体 ---------------------------
+type performanceStats struct {
+	lastUpdateTime  time.Time     // 上次更新时间
+	updateInterval  time.Duration // 更新间隔
+	speedSamples    []float64     // 速度采样数组
+	maxSpeedSamples int           // 最大采样数
+	lastBytes       int64         // 上次字节数
+}
+
+// --------------------------- 会话统计 ---------------------------
+// session 保存一次收发会话的统计信息，统计变化时通知观察者
+type session struct {
+	mu       sync.Mutex
+	stats    Stats
+	perf     performanceStats
+	observer Observer
+	limiters []*RateLimiter
+}
+
+func newSession(observer Observer, limiters []*RateLimiter) *session {
+	return &session{
+		stats: Stats{Status: "ready"},
+		perf: performanceStats{
+			updateInterval:  200 * time.Millisecond, // 更新间隔200ms
+			maxSpeedSamples: 10,                     // 最大速度采样数
+			speedSamples:    make([]float64, 0, 10),
+		},
+		observer: observerOrNop(observer),
+		limiters: limiters,
+	}
+}
+
+func (s *session) status(msg string) {
+	s.observer.StatusChanged(msg)
+}
+
+// warn 以 "警告: " 前缀报告不影响传输继续进行的问题
+func (s *session) warn(msg string) {
+	s.status("警告: " + msg)
+}
+
+// update 在持锁状态下修改统计信息并通知观察者
+func (s *session) update(fn func(st *Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.stats)
+	s.observer.StatsUpdated(s.stats)
+}
+
+// fail 将会话标记为失败并通知失败原因
+func (s *session) fail(err error) {
+	s.update(func(st *Stats) { st.Status = "failed" })
+	s.status(err.Error())
+}
+
+// snapshot 返回当前统计信息的副本
+func (s *session) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// throttledWriter 返回受会话令牌桶约束的写入端
+func (s *session) throttledWriter(w io.Writer) io.Writer {
+	return &rateLimitedWriter{w: w, limiters: s.limiters}
+}
+
+// throttledReader 返回受会话令牌桶约束的读取端
+func (s *session) throttledReader(r io.Reader) io.Reader {
+	return &rateLimitedReader{r: r, limiters: s.limiters}
+}
+
+// --------------------------- 优化的统计更新方法 ---------------------------
+func (s *session) progress(currentFile string, transferredBytes int64, startTime time.Time) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 检查是否需要更新（避免频繁更新导致的性能问题）
+	if now.Sub(s.perf.lastUpdateTime) < s.perf.updateInterval {
+		return
+	}
+
+	// 更新当前文件（只显示总体进度，不显示单个文件进度）
+	if currentFile != "" {
+		s.stats.CurrentFile = "传输中..."
+	}
+
+	// 更新传输字节数
+	s.stats.TransferredBytes = transferredBytes
+
+	// 计算进度（基于总字节数）
+	if s.stats.TotalBytes > 0 {
+		// 确保进度计算正确，避免除零错误
+		progress := float64(transferredBytes) / float64(s.stats.TotalBytes) * 100
+
+		// 限制进度范围在0-100之间
+		if progress < 0 {
+			s.stats.Progress = 0
+		} else if progress > 100 {
+			s.stats.Progress = 100
+		} else {
+			s.stats.Progress = progress
+		}
+	} else {
+		// 如果总字节数为0，设置一个小的初始进度
+		s.stats.Progress = 0.1
+	}
+
+	// 计算传输速度（使用滑动窗口平均）
+	elapsed := now.Sub(startTime).Seconds()
+	if elapsed > 0.1 { // 至少需要0.1秒才能计算有效速度
+		currentSpeed := float64(transferredBytes) / (1024 * 1024) / elapsed // MB/s
+
+		// 添加速度采样
+		s.perf.speedSamples = append(s.perf.speedSamples, currentSpeed)
+		if len(s.perf.speedSamples) > s.perf.maxSpeedSamples {
+			s.perf.speedSamples = s.perf.speedSamples[1:]
+		}
+
+		// 计算平均速度（加权平均，最近的速度权重更高）
+		var totalSpeed float64
+		var totalWeight float64
+		for i, speed := range s.perf.speedSamples {
+			weight := float64(i + 1) // 越新的速度权重越高
+			totalSpeed += speed * weight
+			totalWeight += weight
+		}
+		if totalWeight > 0 {
+			s.stats.CurrentSpeed = totalSpeed / totalWeight
+		} else {
+			s.stats.CurrentSpeed = currentSpeed
+		}
+	} else {
+		// 传输刚开始，使用瞬时速度
+		if transferredBytes > 0 {
+			s.stats.CurrentSpeed = float64(transferredBytes) / (1024 * 1024) / elapsed
+		} else {
+			s.stats.CurrentSpeed = 0
+		}
+	}
+
+	// 计算预计剩余时间（使用加权平均速度）
+	if s.stats.CurrentSpeed > 0 && s.stats.TotalBytes > 0 {
+		remainingBytes := s.stats.TotalBytes - transferredBytes
+		remainingSeconds := float64(remainingBytes) / (s.stats.CurrentSpeed * 1024 * 1024)
+
+		// 平滑剩余时间计算，避免剧烈波动
+		if remainingSeconds < 1 {
+			s.stats.EstimatedTime = "<1秒"
+		} else if remainingSeconds < 60 {
+			s.stats.EstimatedTime = fmt.Sprintf("%.0f秒", remainingSeconds)
+		} else if remainingSeconds < 3600 {
+			s.stats.EstimatedTime = fmt.Sprintf("%.1f分钟", remainingSeconds/60)
+		} else {
+			s.stats.EstimatedTime = fmt.Sprintf("%.1f小时", remainingSeconds/3600)
+		}
+	} else {
+		s.stats.EstimatedTime = "计算中..."
+	}
+
+	// 更新限速状态
+	s.stats.RateLimit, s.stats.Throttled = effectiveRateLimit(s.limiters)
+
+	// 更新性能统计
+	s.perf.lastUpdateTime = now
+	s.perf.lastBytes = transferredBytes
+
+	// 通知观察者
+	s.observer.StatsUpdated(s.stats)
+}
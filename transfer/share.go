@@ -0,0 +1,455 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 共享与拉取 ---------------------------
+// 共享端在 SharePort 上公开只读的共享文件夹，其他设备可列出共享、浏览目录并拉取文件或子文件夹。
+// 每个连接处理一个请求，请求为一行：
+//
+//	SHARE_LIST                                 答复 SHARES|数量，随后每行一个共享名
+//	SHARE_BROWSE|共享名|目录相对路径              答复 ENTRIES|数量，随后每行 名称|D或F|大小|修改时间(Unix 纳秒)
+//	SHARE_GET|共享名|相对路径[|相对路径...]        扫描完成后答复 SHARE_OK，随后按发送协议发送所选条目
+//
+// 出错或无权访问时答复 SHARE_ERROR|原因。拉取时共享端作为发送端、拉取端作为接收端，
+// 复用普通传输的清单、统计确认和文件流。共享中的符号链接不会被列出或发送。
+const (
+	SharePort         = 60006
+	ShareListMarker   = "SHARE_LIST"
+	ShareBrowseMarker = "SHARE_BROWSE"
+	ShareGetMarker    = "SHARE_GET"
+	ShareOKMarker     = "SHARE_OK"
+	ShareErrorMarker  = "SHARE_ERROR"
+	sharesMarker      = "SHARES"
+	entriesMarker     = "ENTRIES"
+	shareMaxLines     = 1 << 16 // 共享列表或目录列表最多的行数，限制对端声明的数量
+)
+
+// Share 为一个只读共享文件夹
+type Share struct {
+	Name  string   `json:"name"`  // 共享名，不能包含 "|"、"/" 和 "\"
+	Path  string   `json:"path"`  // 共享的本地文件夹
+	Allow []string `json:"allow"` // 允许访问的设备地址，为空表示所有设备
+}
+
+// allows 判断地址为 peer 的设备能否访问该共享
+func (sh Share) allows(peer string) bool {
+	return len(sh.Allow) == 0 || slices.Contains(sh.Allow, peer)
+}
+
+// ShareEntry 为浏览共享时的一个目录项
+type ShareEntry struct {
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// ShareServer 响应其他设备的浏览和拉取请求。同一时间只处理一个拉取，其余拉取会被告知稍后再试。
+type ShareServer struct {
+	Observer Observer       // 拉取（向对方发送）的进度与状态观察者，可为 nil
+	Limiters []*RateLimiter // 发送时依次申请令牌的令牌桶
+
+	mu     sync.Mutex
+	shares map[string]Share
+	ln     net.Listener
+	sender *Sender // 进行中的拉取，停止服务时中止
+}
+
+// validateShares 检查共享名和路径，返回按名称索引的共享，路径转换为绝对路径
+func validateShares(shares []Share) (map[string]Share, error) {
+	m := make(map[string]Share, len(shares))
+	for _, sh := range shares {
+		if sh.Name == "" || strings.ContainsAny(sh.Name, "|/\\\r\n") {
+			return nil, fmt.Errorf("非法的共享名: %q", sh.Name)
+		}
+		if _, ok := m[sh.Name]; ok {
+			return nil, fmt.Errorf("共享名重复: %s", sh.Name)
+		}
+		abs, err := filepath.Abs(sh.Path)
+		if err != nil {
+			return nil, fmt.Errorf("共享路径无效 %s: %v", sh.Path, err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("获取文件信息失败 %s: %v", sh.Path, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("共享路径不是文件夹: %s", sh.Path)
+		}
+		sh.Path = abs
+		m[sh.Name] = sh
+	}
+	return m, nil
+}
+
+// SetShares 替换共享列表，对之后的请求生效
+func (s *ShareServer) SetShares(shares []Share) error {
+	m, err := validateShares(shares)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.shares = m
+	s.mu.Unlock()
+	return nil
+}
+
+// Shares 返回当前的共享列表，按名称排序
+func (s *ShareServer) Shares() []Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Share, 0, len(s.shares))
+	for _, sh := range s.shares {
+		list = append(list, sh)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Start 在 addr（如 ":60006"）上开始响应请求
+func (s *ShareServer) Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听端口失败: %v", err)
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return nil
+}
+
+// Stop 停止接受请求并中止进行中的拉取
+func (s *ShareServer) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sender != nil {
+		s.sender.Cancel()
+	}
+	if s.ln == nil {
+		return nil
+	}
+	err := s.ln.Close()
+	s.ln = nil
+	return err
+}
+
+// lookup 返回 peer 可访问的共享，不存在与无权访问不作区分
+func (s *ShareServer) lookup(name, peer string) (Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh, ok := s.shares[name]
+	if !ok || !sh.allows(peer) {
+		return Share{}, fmt.Errorf("共享不存在或无权访问: %s", name)
+	}
+	return sh, nil
+}
+
+// resolve 将共享内的相对路径转换为本地路径，拒绝借助符号链接跳出共享文件夹的路径
+func (sh Share) resolve(rel string) (string, error) {
+	full := sh.Path
+	if rel = strings.Trim(rel, "/"); rel != "" {
+		var err error
+		if full, err = safeJoin(sh.Path, rel); err != nil {
+			return "", err
+		}
+	}
+	root, err := filepath.EvalSymlinks(sh.Path)
+	if err != nil {
+		return "", fmt.Errorf("共享不可用: %v", err)
+	}
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return "", fmt.Errorf("路径不存在: %s", rel)
+	}
+	if !within(root, real) {
+		return "", fmt.Errorf("非法路径: %s", rel)
+	}
+	return full, nil
+}
+
+func (s *ShareServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	line, err := readRawLine(conn)
+	if err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	peer, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	parts := strings.Split(line, "|")
+	switch {
+	case parts[0] == ShareListMarker && len(parts) == 1:
+		err = s.handleList(conn, peer)
+	case parts[0] == ShareBrowseMarker && len(parts) == 3:
+		err = s.handleBrowse(conn, peer, parts[1], parts[2])
+	case parts[0] == ShareGetMarker && len(parts) >= 3:
+		err = s.handleGet(conn, peer, parts[1], parts[2:])
+	default:
+		err = fmt.Errorf("无效的共享请求")
+	}
+	if err != nil {
+		conn.SetWriteDeadline(time.Now().Add(HandshakeTimeout))
+		fmt.Fprintf(conn, "%s|%s\n", ShareErrorMarker, strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+}
+
+func (s *ShareServer) handleList(conn net.Conn, peer string) error {
+	var names []string
+	for _, sh := range s.Shares() {
+		if sh.allows(peer) {
+			names = append(names, sh.Name)
+		}
+	}
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "%s|%d\n", sharesMarker, len(names))
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return w.Flush()
+}
+
+func (s *ShareServer) handleBrowse(conn net.Conn, peer, name, dir string) error {
+	sh, err := s.lookup(name, peer)
+	if err != nil {
+		return err
+	}
+	full, err := sh.resolve(dir)
+	if err != nil {
+		return err
+	}
+	items, err := os.ReadDir(full)
+	if err != nil {
+		return fmt.Errorf("读取目录失败: %s", dir)
+	}
+
+	var entries []string
+	for _, item := range items {
+		info, err := item.Info()
+		if err != nil || isSymlink(info) || isPartialName(item.Name()) || strings.ContainsAny(item.Name(), "|\r\n") {
+			continue
+		}
+		kind := "F"
+		if info.IsDir() {
+			kind = "D"
+		}
+		entries = append(entries, fmt.Sprintf("%s|%s|%d|%d", item.Name(), kind, info.Size(), info.ModTime().UnixNano()))
+	}
+	if len(entries) > shareMaxLines {
+		return fmt.Errorf("目录中的条目超过 %d 个: %s", shareMaxLines, dir)
+	}
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "%s|%d\n", entriesMarker, len(entries))
+	for _, e := range entries {
+		fmt.Fprintln(w, e)
+	}
+	return w.Flush()
+}
+
+// handleGet 以发送端身份把所选条目发送给拉取端
+func (s *ShareServer) handleGet(conn net.Conn, peer, name string, rels []string) error {
+	sh, err := s.lookup(name, peer)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		full, err := sh.resolve(rel)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, full)
+	}
+	roots, err := buildSendRoots(paths)
+	if err != nil {
+		return err
+	}
+	// 拉取整个共享时以共享名作为接收端的文件夹名
+	if len(rels) == 1 && strings.Trim(rels[0], "/") == "" {
+		roots[0].Name = sh.Name
+	}
+
+	sender := &Sender{Filter: &Filter{symlinks: SymlinkSkip}, Observer: s.Observer, Limiters: s.Limiters}
+	s.mu.Lock()
+	if s.sender != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("共享端正在发送，请稍后再试")
+	}
+	s.sender = sender
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sender = nil
+		s.mu.Unlock()
+	}()
+
+	sender.sess = newSession(s.Observer, s.Limiters)
+	sender.sess.status(fmt.Sprintf("%s 正在拉取共享 %s", peer, name))
+	connected := false
+	err = sender.sendOver(roots, func() (net.Conn, error) {
+		connected = true
+		if _, err := conn.Write([]byte(ShareOKMarker + "\n")); err != nil {
+			return nil, fmt.Errorf("连接拉取端失败: %v", err)
+		}
+		return conn, nil
+	})
+	if err != nil && !connected {
+		// 扫描失败时拉取端仍在等待答复
+		return err
+	}
+	return nil
+}
+
+// --------------------------- 拉取端 ---------------------------
+// shareRequest 向 target 的共享端发送一个请求并读取首行答复，共享端报错时返回其原因
+func shareRequest(target, request string) (net.Conn, string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(target, strconv.Itoa(SharePort)), TimeoutDuration)
+	if err != nil {
+		return nil, "", fmt.Errorf("连接共享端失败: %v", err)
+	}
+	if _, err := conn.Write([]byte(request + "\n")); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("发送请求失败: %v", err)
+	}
+	// 拉取时共享端先扫描文件再答复，等待时间与等待发送端连接相同
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration * 5))
+	reply, err := readRawLine(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("读取答复失败: %v", err)
+	}
+	if reason, ok := strings.CutPrefix(reply, ShareErrorMarker+"|"); ok {
+		conn.Close()
+		return nil, "", fmt.Errorf("共享端拒绝请求: %s", reason)
+	}
+	return conn, reply, nil
+}
+
+// readShareLines 读取 "标记|数量" 答复之后的各行
+func readShareLines(conn net.Conn, reply, marker string) ([]string, error) {
+	count, err := strconv.Atoi(strings.TrimPrefix(reply, marker+"|"))
+	if !strings.HasPrefix(reply, marker+"|") || err != nil || count < 0 || count > shareMaxLines {
+		return nil, fmt.Errorf("共享端答复格式错误")
+	}
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration))
+	reader := bufio.NewReader(conn)
+	// 数量来自对端，按实际收到的行追加而不预先分配
+	var lines []string
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("读取答复失败: %v", err)
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	return lines, nil
+}
+
+// ListShares 返回 target 上本机有权访问的共享名
+func ListShares(target string) ([]string, error) {
+	conn, reply, err := shareRequest(target, ShareListMarker)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return readShareLines(conn, reply, sharesMarker)
+}
+
+// BrowseShare 列出 target 上共享 share 中 dir 目录（相对共享根目录，斜杠分隔）的内容
+func BrowseShare(target, share, dir string) ([]ShareEntry, error) {
+	if strings.ContainsAny(share+dir, "|\r\n") {
+		return nil, fmt.Errorf("非法路径: %s", dir)
+	}
+	conn, reply, err := shareRequest(target, fmt.Sprintf("%s|%s|%s", ShareBrowseMarker, share, dir))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	lines, err := readShareLines(conn, reply, entriesMarker)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ShareEntry, 0, len(lines))
+	for _, line := range lines {
+		parts := strings.Split(line, "|")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("共享端答复格式错误")
+		}
+		size, err1 := strconv.ParseInt(parts[2], 10, 64)
+		mtime, err2 := strconv.ParseInt(parts[3], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("共享端答复格式错误")
+		}
+		entries = append(entries, ShareEntry{Name: parts[0], IsDir: parts[1] == "D", Size: size, ModTime: time.Unix(0, mtime)})
+	}
+	return entries, nil
+}
+
+// Pull 从 target 的共享 share 拉取 paths 中的文件或文件夹（相对共享根目录，斜杠分隔，为空表示整个共享），
+// 保存到 Dir，阻塞到传输结束。拉取与 Receive 使用相同的接收流程，包括元数据、空间检查和接收后钩子。
+func (r *Receiver) Pull(target, share string, paths []string) (err error) {
+	r.sess = newSession(r.Observer, r.Limiters)
+	defer func() {
+		if err != nil && r.isCanceled() {
+			err = ErrCanceled
+		}
+		if err != nil {
+			r.sess.fail(err)
+		}
+	}()
+
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	request := ShareGetMarker + "|" + share
+	for _, p := range paths {
+		if strings.ContainsAny(p, "|\r\n") {
+			return fmt.Errorf("非法路径: %s", p)
+		}
+		request += "|" + p
+	}
+
+	destDir := r.Dir
+	if destDir == "" {
+		destDir = "."
+	}
+	r.sess.status(fmt.Sprintf("正在请求共享 %s...", share))
+	conn, reply, err := shareRequest(target, request)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if reply != ShareOKMarker {
+		return fmt.Errorf("共享端答复格式错误")
+	}
+	if err = r.attach(conn); err != nil {
+		return err
+	}
+
+	r.sess.status("已连接到共享端，开始接收...")
+	r.pulling = true
+	return r.serve(conn, destDir)
+}
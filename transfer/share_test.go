@@ -0,0 +1,80 @@
+package transfer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// 拉取时共享端只应发来文件、目录和链接，同步、文本消息和其他条目都应拒绝
+func TestPullAcceptsOnlyPlainEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		wantErr bool
+	}{
+		{"文件和目录", "d|DIR\n" + StatsMarker + "|1|2\n" + DirHeaderPrefix + "|d|755|0\n" + FileHeaderPrefix + "|d/a.txt|2|644|0\nhi" + EndMarker + "\n", false},
+		{"同步请求", SyncMarker + "|d\n" + SyncDeleteMarker + "|keep.txt\n" + SyncDoneMarker + "\n", true},
+		{"文本消息", TextMarker + "|2\nhi", true},
+		{"去重条目", "d|DIR\n" + StatsMarker + "|1|2\n" + DupHeaderPrefix + "|d/b.txt|2|644|0|d/keep.txt\n" + EndMarker + "\n", true},
+		{"流式条目", "d|DIR\n" + StatsMarker + "|1|0\n" + StreamHeaderPrefix + "|d/c.txt|644|0\n" + EndMarker + "\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			writeTree(t, dest, map[string]string{"d/keep.txt": "k"})
+			var texts []TextMessage
+			r := &Receiver{Dir: dest, AllowSync: true, TextObserver: textRecorder(func(m TextMessage) { texts = append(texts, m) }), pulling: true}
+			err := receiveRaw(t, r, tt.stream)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v，期望出错 = %v", err, tt.wantErr)
+			}
+			if len(texts) != 0 {
+				t.Errorf("拉取时收到了文本消息: %v", texts)
+			}
+			if _, err := os.Stat(filepath.Join(dest, "d", "keep.txt")); err != nil {
+				t.Errorf("已有文件被删除: %v", err)
+			}
+			for _, name := range []string{"b.txt", "c.txt"} {
+				if _, err := os.Stat(filepath.Join(dest, "d", name)); err == nil {
+					t.Errorf("写入了不接受的条目 %s", name)
+				}
+			}
+		})
+	}
+}
+
+type textRecorder func(TextMessage)
+
+func (f textRecorder) TextReceived(m TextMessage) { f(m) }
+
+// 共享端声明的行数过大时应拒绝，不能按声明的数量分配内存
+func TestReadShareLinesCountLimit(t *testing.T) {
+	read := func(reply, body string) ([]string, error) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			server.Write([]byte(body))
+			server.Close()
+		}()
+		return readShareLines(client, reply, entriesMarker)
+	}
+
+	for _, count := range []string{"4611686018427387904", strconv.Itoa(shareMaxLines + 1), "-1", "x"} {
+		if _, err := read(entriesMarker+"|"+count, "a|F|1|0\n"); err == nil {
+			t.Errorf("行数 %s 应被拒绝", count)
+		}
+	}
+	if _, err := read(sharesMarker+"|1", "a\n"); err == nil {
+		t.Error("标记不符时应被拒绝")
+	}
+	if _, err := read(entriesMarker+"|3", "a|F|1|0\n"); err == nil {
+		t.Error("行数不足时应失败")
+	}
+	lines, err := read(entriesMarker+"|2", "a|F|1|0\r\nb|D|0|0\n")
+	if err != nil || len(lines) != 2 || lines[0] != "a|F|1|0" || lines[1] != "b|D|0|0" {
+		t.Errorf("lines = %q, %v", lines, err)
+	}
+}
@@ -0,0 +1,108 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --------------------------- 稀疏文件协议 ---------------------------
+// 稀疏文件头: SPARSE_START|相对路径|逻辑大小|权限(八进制)|修改时间(Unix 纳秒)|数据段数
+// 其后紧跟数据段数行 "偏移|长度"，再依次发送各数据段的内容，空洞部分不传输。
+const (
+	SparseHeaderPrefix = "SPARSE_START"
+	sparseMaxExtents   = 1 << 20 // 单个文件最多的数据段数，更多时按普通文件发送
+)
+
+// extent 为文件中的一个数据段
+type extent struct {
+	Offset int64
+	Length int64
+}
+
+// sparseExtents 返回稀疏文件的数据段；文件不稀疏或系统不支持空洞探测时返回 nil
+func sparseExtents(f *os.File, size int64) []extent {
+	extents, err := dataExtents(f, size)
+	if err != nil || len(extents) > sparseMaxExtents {
+		return nil
+	}
+	var dataBytes int64
+	for _, e := range extents {
+		dataBytes += e.Length
+	}
+	if dataBytes >= size {
+		return nil
+	}
+	return extents
+}
+
+// diskUsage 返回文件在接收端实际写入的字节数：会按稀疏文件发送时只计数据段，否则为逻辑大小
+func diskUsage(path string, info os.FileInfo) int64 {
+	if !mayBeSparse(info) {
+		return info.Size()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return info.Size()
+	}
+	defer f.Close()
+	extents := sparseExtents(f, info.Size())
+	if extents == nil {
+		return info.Size()
+	}
+	var dataBytes int64
+	for _, e := range extents {
+		dataBytes += e.Length
+	}
+	return dataBytes
+}
+
+func formatSparseHeader(rel string, info os.FileInfo, extents []extent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s|%d|%o|%d|%d\n", SparseHeaderPrefix, rel, info.Size(), info.Mode().Perm(), info.ModTime().UnixNano(), len(extents))
+	for _, e := range extents {
+		fmt.Fprintf(&b, "%d|%d\n", e.Offset, e.Length)
+	}
+	return b.String()
+}
+
+// readExtents 读取稀疏文件头之后的数据段列表
+func readExtents(reader *bufio.Reader, count int, size int64) ([]extent, error) {
+	if count < 0 || count > sparseMaxExtents {
+		return nil, fmt.Errorf("数据段数量无效: %d", count)
+	}
+	// 数量来自对端，按实际收到的行追加而不预先分配
+	var extents []extent
+	var end int64
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("读取数据段失败: %v", err)
+		}
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("数据段格式错误")
+		}
+		offset, err1 := strconv.ParseInt(parts[0], 10, 64)
+		length, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 != nil || err2 != nil || offset < end || length < 0 || offset+length > size {
+			return nil, fmt.Errorf("数据段格式错误")
+		}
+		end = offset + length
+		extents = append(extents, extent{Offset: offset, Length: length})
+	}
+	return extents, nil
+}
+
+// allocateExtents 为各数据段预分配空间并把文件设为逻辑大小，未写入的部分保留为空洞。
+// 磁盘空间不足时在写入任何数据之前返回错误。
+func allocateExtents(f *os.File, size int64, extents []extent) error {
+	for _, e := range extents {
+		if err := preallocate(f, e.Offset, e.Length); err != nil {
+			return err
+		}
+	}
+	return f.Truncate(size)
+}
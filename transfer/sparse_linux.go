@@ -0,0 +1,73 @@
+//go:build linux
+
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// mayBeSparse 根据已分配的块数判断文件是否可能含有空洞，只有这些文件才需要探测数据段
+func mayBeSparse(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Blocks*512 < info.Size()
+}
+
+// lseek 的 whence 取值，syscall 包未导出
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// dataExtents 使用 SEEK_DATA/SEEK_HOLE 探测文件中的数据段
+func dataExtents(f *os.File, size int64) ([]extent, error) {
+	defer f.Seek(0, io.SeekStart)
+
+	// 全部为空洞的文件返回空切片而非 nil，以区别于"不稀疏"
+	extents := []extent{}
+	var off int64
+	for off < size {
+		data, err := f.Seek(off, seekData)
+		if err != nil {
+			// ENXIO 表示 off 之后只剩空洞
+			if errors.Is(err, syscall.ENXIO) {
+				break
+			}
+			return nil, err
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		if hole > data {
+			extents = append(extents, extent{Offset: data, Length: hole - data})
+		}
+		off = hole
+	}
+	return extents, nil
+}
+
+// preallocate 为文件的 [off, off+length) 预先分配磁盘空间。
+// 空间不足时返回错误；文件系统不支持 fallocate 时静默跳过。
+func preallocate(f *os.File, off, length int64) error {
+	if length <= 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), 0, off, length)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, syscall.ENOSPC):
+		return fmt.Errorf("磁盘空间不足，无法预分配 %s", FormatFileSize(length))
+	case errors.Is(err, syscall.EOPNOTSUPP), errors.Is(err, syscall.ENOSYS), errors.Is(err, syscall.EINVAL):
+		return nil
+	default:
+		return fmt.Errorf("预分配磁盘空间失败: %v", err)
+	}
+}
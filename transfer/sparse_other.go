@@ -0,0 +1,23 @@
+//go:build !linux
+
+package transfer
+
+import (
+	"fmt"
+	"os"
+)
+
+// dataExtents 在不支持 SEEK_DATA/SEEK_HOLE 的平台上按普通文件处理
+func dataExtents(f *os.File, size int64) ([]extent, error) {
+	return nil, fmt.Errorf("不支持空洞探测")
+}
+
+// mayBeSparse 在不支持空洞探测的平台上总是返回 false
+func mayBeSparse(info os.FileInfo) bool {
+	return false
+}
+
+// preallocate 在不支持 fallocate 的平台上不做处理
+func preallocate(f *os.File, off, length int64) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 对端声明的数据段数量过大时应在分配之前拒绝
+func TestSparseExtentLimits(t *testing.T) {
+	header := strings.Join([]string{SparseHeaderPrefix, "a.img", "1024", "644", "0", "4611686018427387904"}, "|")
+	if _, err := parseEntryHeader(header); err == nil {
+		t.Error("超大的数据段数量应被拒绝")
+	}
+	if _, err := readExtents(bufio.NewReader(strings.NewReader("0|1\n")), sparseMaxExtents+1, 1024); err == nil {
+		t.Error("readExtents 应拒绝超过上限的数量")
+	}
+
+	tests := []struct {
+		name  string
+		lines string
+		count int
+	}{
+		{"重叠", "0|10\n5|10\n", 2},
+		{"超出文件大小", "1000|100\n", 1},
+		{"负长度", "0|-1\n", 1},
+		{"行数不足", "0|10\n", 3},
+		{"格式错误", "abc\n", 1},
+	}
+	for _, tt := range tests {
+		if _, err := readExtents(bufio.NewReader(strings.NewReader(tt.lines)), tt.count, 1024); err == nil {
+			t.Errorf("%s: 应失败", tt.name)
+		}
+	}
+
+	extents, err := readExtents(bufio.NewReader(strings.NewReader("0|10\n100|24\n")), 2, 1024)
+	if err != nil || len(extents) != 2 || extents[1] != (extent{Offset: 100, Length: 24}) {
+		t.Errorf("readExtents = %v, %v", extents, err)
+	}
+}
+
+func TestSparseHeaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.img")
+	if err := os.WriteFile(path, make([]byte, 1024), 0640); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []extent{{0, 10}, {512, 100}}
+	reader := bufio.NewReader(strings.NewReader(formatSparseHeader("dir/a.img", info, want)))
+	line, _ := reader.ReadString('\n')
+	h, err := parseEntryHeader(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsSparse || h.RelPath != "dir/a.img" || h.Size != 1024 || h.ExtentCount != len(want) {
+		t.Fatalf("文件头 = %+v", h)
+	}
+	got, err := readExtents(reader, h.ExtentCount, h.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("数据段 %d = %v，应为 %v", i, got[i], want[i])
+		}
+	}
+}
+
+// 稀疏文件经过传输后内容不变，接收端保留空洞
+func TestSparseTransferKeepsHoles(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 32 << 20
+	head := bytes.Repeat([]byte("head"), 1024)
+	tail := bytes.Repeat([]byte("tail"), 1024)
+	if _, err := f.Write(head); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(tail, 16<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	extents := sparseExtents(f, size)
+	f.Close()
+	if extents == nil {
+		t.Skip("平台或文件系统不支持稀疏文件")
+	}
+
+	dest := t.TempDir()
+	sendErr, recvErr := sendLoopback(t, &Sender{}, &Receiver{Dir: dest}, []string{src}, nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("发送: %v, 接收: %v", sendErr, recvErr)
+	}
+
+	got := filepath.Join(dest, "disk.img")
+	data, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, size)
+	copy(want, head)
+	copy(want[16<<20:], tail)
+	if !bytes.Equal(data, want) {
+		t.Fatal("接收到的内容与源文件不同")
+	}
+
+	info, err := os.Stat(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mayBeSparse(info) {
+		t.Errorf("接收到的文件没有空洞 (大小 %d)", info.Size())
+	}
+}
@@ -0,0 +1,137 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 数据按不超过 streamChunkSize 的块发出，以长度为 0 的块结束
+func TestChunkFraming(t *testing.T) {
+	data := make([]byte, 2*streamChunkSize+streamChunkSize/2)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		cw := &chunkWriter{conn: client, w: client}
+		cw.Write(data)
+		cw.Close()
+		client.Close()
+	}()
+
+	reader := bufio.NewReader(server)
+	var lengths []int
+	var got []byte
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			t.Fatalf("数据块长度行 %q", line)
+		}
+		lengths = append(lengths, n)
+		if n == 0 {
+			break
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, chunk...)
+	}
+	want := []int{streamChunkSize, streamChunkSize, streamChunkSize / 2, 0}
+	if len(lengths) != len(want) {
+		t.Fatalf("数据块长度 = %v，应为 %v", lengths, want)
+	}
+	for i := range want {
+		if lengths[i] != want[i] {
+			t.Errorf("数据块 %d 长度 = %d，应为 %d", i, lengths[i], want[i])
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("还原的数据与原数据不同")
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		client.Write([]byte("3\nabc2\nde0\n"))
+		client.Close()
+	}()
+	got, err := io.ReadAll(&chunkReader{reader: bufio.NewReader(server), conn: server})
+	if err != nil || string(got) != "abcde" {
+		t.Errorf("chunkReader = %q, %v", got, err)
+	}
+}
+
+func TestReadChunkLengthLimits(t *testing.T) {
+	for _, line := range []string{strconv.Itoa(streamChunkSize + 1), "-1", "4611686018427387904", "x", ""} {
+		if _, err := readChunkLength(bufio.NewReader(strings.NewReader(line + "\n"))); err == nil {
+			t.Errorf("数据块长度 %q 应被拒绝", line)
+		}
+	}
+	if n, err := readChunkLength(bufio.NewReader(strings.NewReader(strconv.Itoa(streamChunkSize) + "\n"))); err != nil || n != streamChunkSize {
+		t.Errorf("readChunkLength = %d, %v", n, err)
+	}
+}
+
+// 超过上限的数据块使接收失败，不留下文件
+func TestReceiveStreamRejectsOversizedChunk(t *testing.T) {
+	dest := t.TempDir()
+	stream := "pipe.bin|FILE\n" + StatsMarker + "|1|0\n" +
+		StreamHeaderPrefix + "|pipe.bin|644|0\n" +
+		"2\nhi" + strconv.Itoa(streamChunkSize+1) + "\n" + strings.Repeat("x", 16) +
+		"0\n" + EndMarker + "\n"
+	if err := receiveRaw(t, &Receiver{Dir: dest}, stream); err == nil || !strings.Contains(err.Error(), "数据块格式错误") {
+		t.Errorf("超过上限的数据块应导致接收失败: %v", err)
+	}
+	for _, name := range []string{"pipe.bin", filepath.Base(partialPathFor("pipe.bin"))} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); !os.IsNotExist(err) {
+			t.Errorf("留下了 %s", name)
+		}
+	}
+}
+
+func TestSendStreamRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("stream-data "), streamChunkSize/4)
+	dest := t.TempDir()
+	addr, done := serveOnce(t, &Receiver{Dir: dest})
+
+	// 以小块读出，模拟管道
+	src := io.MultiReader(bytes.NewReader(data[:100]), bytes.NewReader(data[100:]))
+	if err := (&Sender{}).SendStream(src, "pipe.bin", addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "pipe.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("收到 %d 字节，应为 %d: %v", len(got), len(data), err)
+	}
+
+	// 写到 Output 时内容原样输出
+	var out bytes.Buffer
+	addr, done = serveOnce(t, &Receiver{Dir: t.TempDir(), Output: &out})
+	if err := (&Sender{}).SendStream(bytes.NewReader(data), "pipe.bin", addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Output 收到 %d 字节，应为 %d", out.Len(), len(data))
+	}
+}
@@ -0,0 +1,150 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --------------------------- 符号链接策略 ---------------------------
+const (
+	SymlinkFollow   = "follow" // 跟随链接，按目标内容发送（默认）
+	SymlinkSkip     = "skip"   // 跳过链接
+	SymlinkPreserve = "link"   // 作为链接发送，接收端重建
+)
+
+const LinkHeaderPrefix = "LINK_START"
+
+func validSymlinkPolicy(policy string) bool {
+	switch policy {
+	case "", SymlinkFollow, SymlinkSkip, SymlinkPreserve:
+		return true
+	}
+	return false
+}
+
+// isSymlink 判断 Lstat 得到的信息是否为符号链接
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// isAncestorLoop 判断目录是否与某个祖先目录为同一目录（按设备号/inode 比较）
+func isAncestorLoop(info os.FileInfo, ancestors []os.FileInfo) bool {
+	for _, anc := range ancestors {
+		if os.SameFile(anc, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// --------------------------- 接收端重建 ---------------------------
+// within 判断 path 是否位于 dir 内（两者均为已解析的绝对路径）
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// resolveExisting 跟随符号链接解析 path 中已存在的最长前缀，再拼接其余不存在的部分，返回绝对路径
+func resolveExisting(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// confinedJoin 与 safeJoin 相同，并要求路径按已存在的符号链接解析后仍位于 dir 内，
+// 避免借助保存目录中的链接把文件或目录写到保存目录之外
+func confinedJoin(dir, rel string) (string, error) {
+	p, err := safeJoin(dir, rel)
+	if err != nil {
+		return "", err
+	}
+	realDir, err := resolveExisting(dir)
+	if err != nil {
+		return "", fmt.Errorf("解析保存目录失败: %v", err)
+	}
+	real, err := resolveExisting(p)
+	if err != nil {
+		return "", fmt.Errorf("解析路径失败 %s: %v", rel, err)
+	}
+	if !within(realDir, real) {
+		return "", fmt.Errorf("拒绝写入保存目录之外的路径: %s", rel)
+	}
+	return p, nil
+}
+
+// createConfinedSymlink 在 linkPath 创建指向 target 的符号链接。
+// target 必须是相对路径，".." 只能出现在开头，且按链接所在目录的真实路径和已有链接解析后仍位于 destDir 内。
+// ".." 不允许出现在其他路径段之后，否则经过已有或之后创建的链接再返回上级时，实际位置与按文本计算的不同。
+func createConfinedSymlink(destDir, linkPath, target string) error {
+	local := filepath.FromSlash(target)
+	if target == "" || filepath.IsAbs(local) || filepath.VolumeName(local) != "" || strings.HasPrefix(target, "/") {
+		return fmt.Errorf("拒绝创建指向绝对路径的符号链接: %s -> %s", linkPath, target)
+	}
+	named := false
+	for _, part := range strings.Split(filepath.ToSlash(local), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if named {
+				return fmt.Errorf("拒绝创建经过其他路径后返回上级的符号链接: %s -> %s", linkPath, target)
+			}
+		default:
+			named = true
+		}
+	}
+
+	realDest, err := resolveExisting(destDir)
+	if err != nil {
+		return fmt.Errorf("解析保存目录失败: %v", err)
+	}
+	parent := filepath.Dir(linkPath)
+	realParent, err := resolveExisting(parent)
+	if err != nil {
+		return fmt.Errorf("解析链接所在目录失败: %v", err)
+	}
+	if !within(realDest, realParent) {
+		return fmt.Errorf("拒绝创建指向保存目录之外的符号链接: %s -> %s", linkPath, target)
+	}
+	// 开头的 ".." 作用于链接所在目录的真实路径，其余路径段再按已有链接解析
+	resolved, err := resolveExisting(filepath.Join(realParent, local))
+	if err != nil {
+		return fmt.Errorf("解析链接目标失败: %v", err)
+	}
+	if !within(realDest, resolved) {
+		return fmt.Errorf("拒绝创建指向保存目录之外的符号链接: %s -> %s", linkPath, target)
+	}
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	// 覆盖已存在的同名链接或文件（目录不覆盖）
+	if fi, err := os.Lstat(linkPath); err == nil && !fi.IsDir() {
+		os.Remove(linkPath)
+	}
+	if err := os.Symlink(local, linkPath); err != nil {
+		return fmt.Errorf("创建符号链接失败: %v", err)
+	}
+	return nil
+}
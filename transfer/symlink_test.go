@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// symlinkDirs 返回 outer 和其中的保存目录 dest，系统不支持创建符号链接时跳过测试
+func symlinkDirs(t *testing.T) (outer, dest string) {
+	t.Helper()
+	outer = t.TempDir()
+	dest = filepath.Join(outer, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dest", filepath.Join(outer, "probe")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	return outer, dest
+}
+
+func TestCreateConfinedSymlink(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	os.MkdirAll(filepath.Join(dest, "a", "b"), 0755)
+	// 用户自己放在保存目录中、指向外部的链接
+	if err := os.Symlink(outer, filepath.Join(dest, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		link, target string
+		ok           bool
+	}{
+		{"a/sib", "b", true},
+		{"a/b/up", "..", true},
+		{"a/b/top", "../..", true},
+		{"a/b/esc", "../../..", false},
+		{"abs", "/etc", false},
+		{"mid", "a/../..", false},
+		{"mid2", "a/b/../x", false},
+		{"via-out", "out", false},
+		{"via-out2", "out/dest/../x", false},
+		{"new/dir/l", "../../a", true},
+		{"out/x", "y", false},
+	}
+	for _, tt := range tests {
+		err := createConfinedSymlink(dest, filepath.Join(dest, filepath.FromSlash(tt.link)), tt.target)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s -> %s: err = %v，期望成功 = %v", tt.link, tt.target, err, tt.ok)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(outer, "x")); err == nil {
+		t.Error("在保存目录之外创建了链接")
+	}
+}
+
+func TestConfinedJoin(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	os.MkdirAll(filepath.Join(dest, "sub"), 0755)
+	os.Symlink("sub", filepath.Join(dest, "in"))
+	os.Symlink(outer, filepath.Join(dest, "out"))
+
+	for rel, ok := range map[string]bool{
+		"f":           true,
+		"new/deep/f":  true,
+		"in/f":        true,
+		"out/f":       false,
+		"out":         false,
+		"../f":        false,
+		"sub/../../f": false,
+	} {
+		if _, err := confinedJoin(dest, rel); (err == nil) != ok {
+			t.Errorf("confinedJoin(%q): err = %v，期望成功 = %v", rel, err, ok)
+		}
+	}
+}
+
+// 链接 up -> ".." 之后，esc -> "a/b/up/../../.." 按文本计算仍在保存目录内，实际却指向其上级，
+// 随后的 esc/x 不能写到保存目录之外
+func TestChainedSymlinkEscape(t *testing.T) {
+	outer, dest := symlinkDirs(t)
+	stream := "t|DIR\n" +
+		StatsMarker + "|1|1\n" +
+		"DIR_START|t|755|0\n" +
+		"DIR_START|t/a|755|0\n" +
+		"DIR_START|t/a/b|755|0\n" +
+		"LINK_START|t/a/b/up|..\n" +
+		"LINK_START|t/esc|a/b/up/../../..\n" +
+		"LINK_START|t/esc2|a/b/up/../..\n" +
+		"FILE_START|t/esc/x|1|644|0\nX" +
+		"FILE_START|t/esc2/y|1|644|0\nY" +
+		EndMarker + "\n"
+	err := receiveRaw(t, &Receiver{Dir: dest}, stream)
+	t.Logf("接收结果: %v", err)
+
+	for _, p := range []string{filepath.Join(outer, "x"), filepath.Join(outer, "y"), filepath.Join(dest, "y")} {
+		if _, err := os.Lstat(p); err == nil {
+			t.Errorf("文件写到了 %s", p)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "t", "a", "b", "up")); err != nil {
+		t.Errorf("合法的链接 up 未创建: %v", err)
+	}
+	// 被拒绝的链接不创建，其后的文件写入保存目录内的同名普通目录
+	for _, name := range []string{"esc", "esc2"} {
+		if fi, err := os.Lstat(filepath.Join(dest, "t", name)); err == nil && isSymlink(fi) {
+			t.Errorf("链接 %s 不应创建", name)
+		}
+	}
+}
@@ -0,0 +1,778 @@
+package transfer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 双向同步协议 ---------------------------
+// 发起端连接接收端后以 "SYNC|文件夹名" 代替清单，接收端同步其保存目录下的同名文件夹：
+//
+//	接收端 → 发起端: SYNC_ENTRY|路径|大小|修改时间|SHA-256 ... SYNC_END
+//	发起端 → 接收端: SYNC_ABORT（仅预览）或 STATS_INFO|上传文件数|上传字节数，接收端答复 ACCEPT/REJECT
+//	发起端 → 接收端: SYNC_RENAME|路径|新路径、SYNC_DELETE|路径、FILE_START 文件头及内容（上传）、
+//	                 SYNC_GET|路径（接收端以 FILE_START 文件头及内容或 SYNC_MISSING|路径 答复）
+//	发起端 → 接收端: SYNC_DONE，接收端保存同步状态后答复 SYNC_OK
+//
+// 双方在文件夹内的 SyncStateFile 中记录上次同步完成时的文件列表，据此区分删除与新增。
+const (
+	SyncMarker        = "SYNC"
+	SyncEntryMarker   = "SYNC_ENTRY"
+	SyncEndMarker     = "SYNC_END"
+	SyncAbortMarker   = "SYNC_ABORT"
+	SyncRenameMarker  = "SYNC_RENAME"
+	SyncDeleteMarker  = "SYNC_DELETE"
+	SyncGetMarker     = "SYNC_GET"
+	SyncMissingMarker = "SYNC_MISSING"
+	SyncDoneMarker    = "SYNC_DONE"
+	SyncOKMarker      = "SYNC_OK"
+	SyncStateFile     = ".lanfile-sync.json"
+)
+
+// 同步计划中的操作
+const (
+	SyncUpload       = "upload"        // 本地文件发送到对方
+	SyncDownload     = "download"      // 对方文件下载到本地
+	SyncDeleteRemote = "delete-remote" // 本地已删除，删除对方的文件
+	SyncDeleteLocal  = "delete-local"  // 对方已删除，删除本地的文件
+	SyncConflict     = "conflict"      // 双方都修改过：本地版本保留原名，对方版本以冲突名称保存在双方
+)
+
+// SyncChange 为同步计划中的一项变更
+type SyncChange struct {
+	Path         string `json:"path"`         // 相对同步文件夹的斜杠路径
+	Action       string `json:"action"`       // upload、download、delete-remote、delete-local 或 conflict
+	Size         int64  `json:"size"`         // 需传输的字节数
+	ConflictPath string `json:"conflictPath"` // 冲突时对方版本的保存路径
+}
+
+// SyncPlan 为一次同步需执行的变更
+type SyncPlan struct {
+	Changes       []SyncChange `json:"changes"`
+	UploadBytes   int64        `json:"uploadBytes"`
+	DownloadBytes int64        `json:"downloadBytes"`
+}
+
+// syncEntry 为同步清单中的一个文件
+type syncEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Hash    string `json:"hash"`
+}
+
+// syncState 为 SyncStateFile 的内容
+type syncState struct {
+	Files map[string]syncEntry `json:"files"`
+}
+
+// loadSyncState 读取上次同步完成时的文件列表，不存在时返回空列表
+func loadSyncState(root string) map[string]syncEntry {
+	var state syncState
+	if data, err := os.ReadFile(filepath.Join(root, SyncStateFile)); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]syncEntry)
+	}
+	return state.Files
+}
+
+// saveSyncState 重新扫描文件夹并记录为本次同步完成时的文件列表
+func saveSyncState(root string, base map[string]syncEntry) error {
+	files, err := scanSyncDir(root, base)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(syncState{Files: files})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(root, SyncStateFile), data); err != nil {
+		return fmt.Errorf("保存同步状态失败: %v", err)
+	}
+	return nil
+}
+
+// scanSyncDir 列出 root 下的普通文件及其哈希。大小和修改时间与 cache 一致时沿用其中的哈希。
+// 同步状态文件、接收中的临时文件以及名称含 "|" 或换行的文件不参与同步。
+func scanSyncDir(root string, cache map[string]syncEntry) (map[string]syncEntry, error) {
+	files := make(map[string]syncEntry)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isPartialName(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == SyncStateFile || strings.ContainsAny(rel, "|\r\n") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := syncEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		if c, ok := cache[rel]; ok && c.Size == e.Size && c.ModTime == e.ModTime {
+			e.Hash = c.Hash
+		} else if e.Hash, err = hashFile(p); err != nil {
+			return err
+		}
+		files[rel] = e
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("扫描同步文件夹失败: %v", err)
+	}
+	return files, nil
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeSyncManifest 发送文件夹的同步清单
+func writeSyncManifest(conn net.Conn, files map[string]syncEntry) error {
+	w := bufio.NewWriter(conn)
+	for _, rel := range sortedPaths(files) {
+		e := files[rel]
+		fmt.Fprintf(w, "%s|%s|%d|%d|%s\n", SyncEntryMarker, rel, e.Size, e.ModTime, e.Hash)
+	}
+	fmt.Fprintln(w, SyncEndMarker)
+	return w.Flush()
+}
+
+// readSyncManifest 读取对方的同步清单
+func readSyncManifest(reader *bufio.Reader) (map[string]syncEntry, error) {
+	files := make(map[string]syncEntry)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("读取同步清单失败: %v", err)
+		}
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		switch {
+		case parts[0] == SyncEndMarker:
+			return files, nil
+		case parts[0] == RejectMarker && len(parts) == 2:
+			return nil, fmt.Errorf("接收端拒绝同步: %s", parts[1])
+		case parts[0] == SyncEntryMarker && len(parts) == 5:
+			size, err1 := strconv.ParseInt(parts[2], 10, 64)
+			mtime, err2 := strconv.ParseInt(parts[3], 10, 64)
+			if err1 != nil || err2 != nil || size < 0 {
+				return nil, fmt.Errorf("同步清单格式错误")
+			}
+			files[parts[1]] = syncEntry{Size: size, ModTime: mtime, Hash: parts[4]}
+		default:
+			return nil, fmt.Errorf("同步清单格式错误")
+		}
+	}
+}
+
+func sortedPaths(files map[string]syncEntry) []string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// --------------------------- 同步计划 ---------------------------
+// planSync 以上次同步的文件列表 base 为共同祖先，比较本地与对方的清单：
+// 只有一方变化时将其变化应用到另一方；一方删除而另一方修改时保留修改；双方都修改且内容不同时按冲突处理。
+func planSync(local, remote, base map[string]syncEntry, now time.Time) SyncPlan {
+	all := make(map[string]syncEntry)
+	for _, m := range []map[string]syncEntry{local, remote, base} {
+		for p, e := range m {
+			all[p] = e
+		}
+	}
+
+	same := func(a, b map[string]syncEntry, p string) bool {
+		x, xok := a[p]
+		y, yok := b[p]
+		if !xok || !yok {
+			return xok == yok
+		}
+		return x.Hash == y.Hash
+	}
+
+	var plan SyncPlan
+	for _, p := range sortedPaths(all) {
+		if same(local, remote, p) {
+			continue
+		}
+		l, lok := local[p]
+		r, rok := remote[p]
+		localChanged, remoteChanged := !same(local, base, p), !same(remote, base, p)
+
+		c := SyncChange{Path: p}
+		switch {
+		case !remoteChanged && lok, remoteChanged && localChanged && !rok:
+			// 只有本地变化，或对方删除而本地修改
+			c.Action, c.Size = SyncUpload, l.Size
+		case !remoteChanged:
+			c.Action = SyncDeleteRemote
+		case !localChanged && rok, !lok:
+			// 只有对方变化，或本地删除而对方修改
+			c.Action, c.Size = SyncDownload, r.Size
+		case !localChanged:
+			c.Action = SyncDeleteLocal
+		default:
+			c.Action, c.Size = SyncConflict, l.Size+r.Size
+			c.ConflictPath = conflictPath(p, now, func(name string) bool {
+				_, inLocal := local[name]
+				_, inRemote := remote[name]
+				return inLocal || inRemote
+			})
+		}
+
+		switch c.Action {
+		case SyncUpload:
+			plan.UploadBytes += l.Size
+		case SyncDownload:
+			plan.DownloadBytes += r.Size
+		case SyncConflict:
+			plan.UploadBytes += l.Size
+			plan.DownloadBytes += r.Size
+		}
+		plan.Changes = append(plan.Changes, c)
+	}
+	return plan
+}
+
+// conflictPath 为冲突文件生成不与现有文件重名的路径，如 "a (conflict 20240102-150405).txt"
+func conflictPath(p string, now time.Time, exists func(string) bool) string {
+	dir, name := path.Split(p)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	suffix := "conflict " + now.Format("20060102-150405")
+	candidate := fmt.Sprintf("%s%s (%s)%s", dir, stem, suffix, ext)
+	for i := 2; exists(candidate); i++ {
+		candidate = fmt.Sprintf("%s%s (%s %d)%s", dir, stem, suffix, i, ext)
+	}
+	return candidate
+}
+
+// --------------------------- 文件收发 ---------------------------
+// writeSyncFile 以 FILE_START 文件头发送一个文件
+func writeSyncFile(conn net.Conn, sess *session, fullPath, rel string, onChunk func(int64)) error {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Errorf("打开文件失败 %s: %v", fullPath, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("获取文件信息失败 %s: %v", fullPath, err)
+	}
+	if _, err := conn.Write([]byte(formatFileHeader(rel, fi))); err != nil {
+		return fmt.Errorf("发送文件头失败 %s: %v", rel, err)
+	}
+	if _, err := sendFileContent(conn, sess.throttledWriter(conn), f, fi.Size(), onChunk); err != nil {
+		return fmt.Errorf("发送文件内容失败 %s: %v", rel, err)
+	}
+	return nil
+}
+
+// readSyncFile 按文件头接收一个文件到 root 下，先写入临时文件，完成后替换原文件并恢复修改时间。
+// sum 不为空时为对方清单中的哈希，内容不符时不替换原文件。
+func readSyncFile(reader *bufio.Reader, conn net.Conn, sess *session, root string, hdr entryHeader, sum string, onChunk func(int64)) (string, error) {
+	if hdr.IsDir || hdr.IsLink || hdr.IsSparse || hdr.IsDelta || hdr.IsDup || hdr.RelPath == SyncStateFile {
+		return "", fmt.Errorf("同步不支持的条目: %s", hdr.RelPath)
+	}
+	targetPath, err := confinedJoin(root, hdr.RelPath)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %v", err)
+	}
+	partialPath := partialPathFor(targetPath)
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("创建文件失败: %v", err)
+	}
+	_, err = receiveFileContent(file, reader, conn, sess.throttledReader(conn), hdr.Size, onChunk)
+	if err == nil {
+		err = commitPartialSum(file, partialPath, targetPath, hdr.Size, sum)
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return "", fmt.Errorf("写入文件失败 %s: %v", hdr.RelPath, err)
+	}
+	// 修改时间需与对方一致，下次扫描时才能沿用哈希
+	if err := applyMetadata(targetPath, hdr); err != nil {
+		sess.warn(err.Error())
+	}
+	return targetPath, nil
+}
+
+// removeSyncFile 删除 root 下的文件，并删除因此变空的上级目录
+func removeSyncFile(root, rel string) error {
+	if rel == SyncStateFile {
+		return fmt.Errorf("非法路径: %s", rel)
+	}
+	target, err := confinedJoin(root, rel)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除文件失败: %v", err)
+	}
+	for dir := filepath.Dir(target); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// renameSyncFile 将冲突文件移到新路径。只移动普通文件：移动目录或链接会改变其中相对链接的指向。
+func renameSyncFile(root, from, to string) error {
+	if from == SyncStateFile || to == SyncStateFile {
+		return fmt.Errorf("非法路径: %s", to)
+	}
+	src, err := confinedJoin(root, from)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(src); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("只能重命名普通文件: %s", from)
+	}
+	dst, err := confinedJoin(root, to)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("重命名文件失败: %v", err)
+	}
+	return nil
+}
+
+// --------------------------- 发起端 ---------------------------
+// Syncer 将本地文件夹与接收端保存目录下的同名文件夹双向同步。接收端需处于接收状态。
+type Syncer struct {
+	Dir      string         // 本地文件夹
+	Observer Observer       // 进度与状态观察者，可为 nil
+	Limiters []*RateLimiter // 收发时依次申请令牌的令牌桶
+
+	sess     *session
+	mu       sync.Mutex
+	conn     net.Conn
+	canceled bool
+}
+
+// Cancel 中止进行中的同步，已完成的文件保留，下次同步时继续
+func (s *Syncer) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.canceled = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *Syncer) attach(conn net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canceled {
+		return ErrCanceled
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *Syncer) isCanceled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.canceled
+}
+
+// Plan 与接收端交换清单并返回同步计划，不修改任何文件。target 为空时自动发现。
+// 预览同样占用对方的一次接收：对方收到预览后结束本次接收，需再次开始接收才能执行同步。
+func (s *Syncer) Plan(target string) (SyncPlan, error) {
+	return s.run(target, false)
+}
+
+// Sync 与接收端交换清单并执行同步，返回执行的计划。target 为空时自动发现。
+func (s *Syncer) Sync(target string) (SyncPlan, error) {
+	return s.run(target, true)
+}
+
+func (s *Syncer) run(target string, execute bool) (plan SyncPlan, err error) {
+	s.sess = newSession(s.Observer, s.Limiters)
+	defer func() {
+		if err != nil && s.isCanceled() {
+			err = ErrCanceled
+		}
+		if err != nil {
+			s.sess.fail(err)
+		}
+	}()
+
+	root, err := filepath.Abs(s.Dir)
+	if err != nil {
+		return plan, fmt.Errorf("无效的同步文件夹: %v", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return plan, fmt.Errorf("同步文件夹不存在: %s", root)
+	}
+
+	s.sess.update(func(st *Stats) { st.Status = "scanning" })
+	s.sess.status("正在扫描本地文件...")
+	base := loadSyncState(root)
+	local, err := scanSyncDir(root, base)
+	if err != nil {
+		return plan, err
+	}
+
+	if target == "" {
+		if target, err = (&Discoverer{}).FindFirst(); err != nil {
+			return plan, fmt.Errorf("发现接收端失败: %v", err)
+		}
+	}
+	conn, err := net.DialTimeout("tcp", receiverAddr(target), TimeoutDuration)
+	if err != nil {
+		return plan, fmt.Errorf("连接接收端失败: %v", err)
+	}
+	defer conn.Close()
+	if err = s.attach(conn); err != nil {
+		return plan, err
+	}
+	s.sess.status("已连接到接收端: " + target)
+
+	if _, err = fmt.Fprintf(conn, "%s|%s\n", SyncMarker, filepath.Base(root)); err != nil {
+		return plan, fmt.Errorf("发送同步请求失败: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration))
+	remote, err := readSyncManifest(reader)
+	if err != nil {
+		return plan, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	plan = planSync(local, remote, base, time.Now())
+	if !execute {
+		conn.Write([]byte(SyncAbortMarker + "\n"))
+		s.sess.update(func(st *Stats) { st.Status = "completed" })
+		s.sess.status(fmt.Sprintf("同步预览: %d 项变更", len(plan.Changes)))
+		return plan, nil
+	}
+
+	if err = s.execute(conn, reader, root, plan, remote); err != nil {
+		return plan, err
+	}
+	if err = saveSyncState(root, local); err != nil {
+		return plan, err
+	}
+
+	s.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+		st.CompletedFiles = st.TotalFiles
+		st.TransferredBytes = st.TotalBytes
+	})
+	s.sess.status(fmt.Sprintf("同步完成: %d 项变更", len(plan.Changes)))
+	return plan, nil
+}
+
+// execute 按计划执行同步：先处理对方的重命名和删除，再删除本地文件，最后上传和下载。
+// remote 为对方的清单，下载的文件按其中的哈希校验。
+func (s *Syncer) execute(conn net.Conn, reader *bufio.Reader, root string, plan SyncPlan, remote map[string]syncEntry) error {
+	// 冲突时上传本地版本，并下载对方改名后的版本
+	var uploads, downloads []string
+	sums := make(map[string]string)
+	for _, c := range plan.Changes {
+		switch c.Action {
+		case SyncUpload:
+			uploads = append(uploads, c.Path)
+		case SyncDownload:
+			downloads = append(downloads, c.Path)
+			sums[c.Path] = remote[c.Path].Hash
+		case SyncConflict:
+			uploads = append(uploads, c.Path)
+			downloads = append(downloads, c.ConflictPath)
+			sums[c.ConflictPath] = remote[c.Path].Hash
+		}
+	}
+
+	// 告知对方需接收的数据量，由对方检查可用空间
+	if _, err := fmt.Fprintf(conn, "%s|%d|%d\n", StatsMarker, len(uploads), plan.UploadBytes); err != nil {
+		return fmt.Errorf("发送统计信息失败: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	answer, err := reader.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return fmt.Errorf("等待接收端确认失败: %v", err)
+	}
+	if parts := strings.SplitN(strings.TrimSpace(answer), "|", 2); parts[0] == RejectMarker {
+		return fmt.Errorf("接收端拒绝传输: %s", strings.Join(parts[1:], ""))
+	}
+
+	s.sess.update(func(st *Stats) {
+		st.TotalFiles = len(uploads) + len(downloads)
+		st.TotalBytes = plan.UploadBytes + plan.DownloadBytes
+		st.Status = "transferring"
+	})
+	s.sess.status("正在同步...")
+
+	w := bufio.NewWriter(conn)
+	for _, c := range plan.Changes {
+		switch c.Action {
+		case SyncConflict:
+			fmt.Fprintf(w, "%s|%s|%s\n", SyncRenameMarker, c.Path, c.ConflictPath)
+		case SyncDeleteRemote:
+			fmt.Fprintf(w, "%s|%s\n", SyncDeleteMarker, c.Path)
+		case SyncDeleteLocal:
+			if err := removeSyncFile(root, c.Path); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("发送同步操作失败: %v", err)
+	}
+
+	startTime := time.Now()
+	var transferred int64
+	var completed int
+	onChunk := func(rel string) func(int64) {
+		return func(n int64) {
+			transferred += n
+			s.sess.progress(rel, transferred, startTime)
+		}
+	}
+	fileDone := func() {
+		completed++
+		s.sess.update(func(st *Stats) {
+			st.CompletedFiles = completed
+			st.TransferredBytes = transferred
+		})
+	}
+
+	for _, rel := range uploads {
+		fullPath, err := safeJoin(root, rel)
+		if err != nil {
+			return err
+		}
+		if err := writeSyncFile(conn, s.sess, fullPath, rel, onChunk(rel)); err != nil {
+			return err
+		}
+		fileDone()
+	}
+
+	for _, rel := range downloads {
+		if _, err := fmt.Fprintf(conn, "%s|%s\n", SyncGetMarker, rel); err != nil {
+			return fmt.Errorf("请求文件失败 %s: %v", rel, err)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("读取文件头失败: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, SyncMissingMarker+"|") {
+			// 对方文件在同步期间被删除，下次同步时再处理
+			continue
+		}
+		hdr, err := parseEntryHeader(line)
+		if err != nil {
+			return err
+		}
+		if hdr.RelPath != rel {
+			return fmt.Errorf("收到的文件与请求不符: %s", hdr.RelPath)
+		}
+		if _, err := readSyncFile(reader, conn, s.sess, root, hdr, sums[rel], onChunk(rel)); err != nil {
+			return err
+		}
+		fileDone()
+	}
+
+	if _, err := conn.Write([]byte(SyncDoneMarker + "\n")); err != nil {
+		return fmt.Errorf("发送结束标记失败: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration))
+	line, err := reader.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || strings.TrimSpace(line) != SyncOKMarker {
+		return fmt.Errorf("接收端未确认同步完成")
+	}
+	return nil
+}
+
+// --------------------------- 接收端 ---------------------------
+// serveSync 响应发起端的同步请求，同步保存目录下的同名文件夹
+func (r *Receiver) serveSync(conn net.Conn, reader *bufio.Reader, destDir string) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("读取同步请求失败: %v", err)
+	}
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 2 || parts[0] != SyncMarker {
+		return fmt.Errorf("同步请求格式错误")
+	}
+	if !r.AllowSync {
+		conn.Write([]byte(fmt.Sprintf("%s|%s\n", RejectMarker, "接收端未允许文件夹同步")))
+		return fmt.Errorf("已拒绝同步请求: 未允许文件夹同步")
+	}
+	// 只同步保存目录下的一层文件夹，不能是保存目录本身或其上级
+	name := parts[1]
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		conn.Write([]byte(fmt.Sprintf("%s|%s\n", RejectMarker, "非法的文件夹名")))
+		return fmt.Errorf("同步请求格式错误")
+	}
+	root, err := confinedJoin(destDir, name)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("创建同步文件夹失败: %v", err)
+	}
+
+	r.sess.status("正在同步文件夹: " + name)
+	base := loadSyncState(root)
+	files, err := scanSyncDir(root, base)
+	if err != nil {
+		conn.Write([]byte(fmt.Sprintf("%s|%s\n", RejectMarker, err.Error())))
+		return err
+	}
+	if err := writeSyncManifest(conn, files); err != nil {
+		return fmt.Errorf("发送同步清单失败: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	startTime := time.Now()
+	var transferred int64 // 收发的总字节数
+	var completed int
+	onChunk := func(rel string) func(int64) {
+		return func(n int64) {
+			transferred += n
+			r.sess.progress(rel, transferred, startTime)
+		}
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("连接在同步结束前关闭")
+		}
+		line = strings.TrimSpace(line)
+		parts := strings.Split(line, "|")
+
+		switch {
+		case parts[0] == SyncAbortMarker:
+			r.sess.update(func(st *Stats) { st.Status = "completed" })
+			r.sess.status("对方已预览同步计划，未做任何修改")
+			return nil
+
+		case parts[0] == StatsMarker && len(parts) == 3:
+			totalFiles, _ := strconv.Atoi(parts[1])
+			totalBytes, _ := strconv.ParseInt(parts[2], 10, 64)
+			reject, warning := checkDiskSpace(root, totalBytes, r.FreeSpaceMargin)
+			if reject != "" {
+				conn.Write([]byte(fmt.Sprintf("%s|%s\n", RejectMarker, reject)))
+				return fmt.Errorf("已拒绝同步: %s", reject)
+			}
+			if warning != "" {
+				r.sess.status("警告: " + warning)
+			}
+			conn.Write([]byte(AcceptMarker + "\n"))
+			r.sess.update(func(st *Stats) {
+				st.TotalFiles = totalFiles
+				st.TotalBytes = totalBytes
+				st.Status = "transferring"
+			})
+
+		case parts[0] == SyncRenameMarker && len(parts) == 3:
+			if err := renameSyncFile(root, parts[1], parts[2]); err != nil {
+				return err
+			}
+
+		case parts[0] == SyncDeleteMarker && len(parts) == 2:
+			if err := removeSyncFile(root, parts[1]); err != nil {
+				return err
+			}
+
+		case parts[0] == SyncGetMarker && len(parts) == 2:
+			fullPath, err := confinedJoin(root, parts[1])
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(fullPath); err != nil {
+				conn.Write([]byte(fmt.Sprintf("%s|%s\n", SyncMissingMarker, parts[1])))
+				continue
+			}
+			if err := writeSyncFile(conn, r.sess, fullPath, parts[1], onChunk(parts[1])); err != nil {
+				return err
+			}
+
+		case parts[0] == SyncDoneMarker:
+			if err := saveSyncState(root, files); err != nil {
+				return err
+			}
+			conn.Write([]byte(SyncOKMarker + "\n"))
+			r.sess.update(func(st *Stats) {
+				st.Status = "completed"
+				st.Progress = 100
+				st.CompletedFiles = completed
+				st.TransferredBytes = transferred
+			})
+			r.sess.status("文件夹同步完成")
+			return nil
+
+		default:
+			hdr, err := parseEntryHeader(line)
+			if err != nil {
+				return err
+			}
+			r.sess.progress(hdr.RelPath, transferred, startTime)
+			targetPath, err := readSyncFile(reader, conn, r.sess, root, hdr, "", onChunk(hdr.RelPath))
+			if err != nil {
+				return err
+			}
+			completed++
+			r.hooks.fileDone(targetPath, path.Join(name, hdr.RelPath), hdr.Size)
+			r.sess.update(func(st *Stats) {
+				st.CompletedFiles = completed
+				st.TransferredBytes = transferred
+			})
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package transfer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// syncLoopback 由 r 在回环地址上响应一次同步，返回发起端的计划和双方的错误
+func syncLoopback(t *testing.T, s *Syncer, r *Receiver) (SyncPlan, error, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		r.sess = newSession(r.Observer, r.Limiters)
+		done <- r.serve(conn, r.Dir)
+	}()
+
+	plan, syncErr := s.Sync(ln.Addr().String())
+	return plan, syncErr, <-done
+}
+
+func TestSyncRequiresAllowSync(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "docs")
+	writeTree(t, local, map[string]string{"a.txt": "a"})
+	dest := t.TempDir()
+
+	_, syncErr, recvErr := syncLoopback(t, &Syncer{Dir: local}, &Receiver{Dir: dest})
+	if syncErr == nil || recvErr == nil {
+		t.Fatalf("未允许同步时应拒绝: 发起端 %v, 接收端 %v", syncErr, recvErr)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "docs")); !os.IsNotExist(err) {
+		t.Error("拒绝同步时不应创建文件夹")
+	}
+
+	_, syncErr, recvErr = syncLoopback(t, &Syncer{Dir: local}, &Receiver{Dir: dest, AllowSync: true})
+	if syncErr != nil || recvErr != nil {
+		t.Fatalf("发起端: %v, 接收端: %v", syncErr, recvErr)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "docs", "a.txt")); string(data) != "a" {
+		t.Errorf("a.txt = %q", data)
+	}
+}
+
+func TestServeSyncRejectsBadNames(t *testing.T) {
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dest, map[string]string{"keep.txt": "k"})
+
+	for _, name := range []string{"", ".", ".."} {
+		// 同步保存目录本身会让对方删除其中的文件
+		stream := SyncMarker + "|" + name + "\n" + SyncDeleteMarker + "|keep.txt\n" + SyncDoneMarker + "\n"
+		if err := receiveRaw(t, &Receiver{Dir: dest, AllowSync: true}, stream); err == nil {
+			t.Errorf("文件夹名 %q 应被拒绝", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "keep.txt")); err != nil {
+		t.Errorf("保存目录中的文件被删除: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, SyncStateFile)); !os.IsNotExist(err) {
+		t.Error("在保存目录的上级写入了同步状态")
+	}
+}
+
+func TestRenameSyncFileRegularOnly(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"dir/x.txt": "x", "f.txt": "f"})
+
+	if err := renameSyncFile(root, "dir", "moved"); err == nil {
+		t.Error("重命名目录应失败")
+	}
+	if err := renameSyncFile(root, "missing.txt", "moved.txt"); err == nil {
+		t.Error("重命名不存在的文件应失败")
+	}
+	if err := renameSyncFile(root, "f.txt", "sub/g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "sub", "g.txt")); string(data) != "f" {
+		t.Errorf("g.txt = %q", data)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	e := func(content string) syncEntry {
+		return syncEntry{Size: int64(len(content)), Hash: "h-" + content}
+	}
+	files := func(kv ...string) map[string]syncEntry {
+		m := make(map[string]syncEntry)
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = e(kv[i+1])
+		}
+		return m
+	}
+	tests := []struct {
+		name                string
+		local, remote, base map[string]syncEntry
+		action              string // 为空表示无需变更
+	}{
+		{"首次同步，只有本地有", files("a", "1"), files(), files(), SyncUpload},
+		{"首次同步，只有对方有", files(), files("a", "1"), files(), SyncDownload},
+		{"首次同步，内容相同", files("a", "1"), files("a", "1"), files(), ""},
+		{"首次同步，内容不同", files("a", "1"), files("a", "2"), files(), SyncConflict},
+		{"未变化", files("a", "1"), files("a", "1"), files("a", "1"), ""},
+		{"本地修改", files("a", "2"), files("a", "1"), files("a", "1"), SyncUpload},
+		{"对方修改", files("a", "1"), files("a", "2"), files("a", "1"), SyncDownload},
+		{"本地新增", files("a", "1"), files(), files("b", "x"), SyncUpload},
+		{"对方新增", files(), files("a", "1"), files("b", "x"), SyncDownload},
+		{"本地删除", files(), files("a", "1"), files("a", "1"), SyncDeleteRemote},
+		{"对方删除", files("a", "1"), files(), files("a", "1"), SyncDeleteLocal},
+		{"双方都删除", files(), files(), files("a", "1"), ""},
+		{"双方改成相同内容", files("a", "2"), files("a", "2"), files("a", "1"), ""},
+		{"双方都修改", files("a", "2"), files("a", "3"), files("a", "1"), SyncConflict},
+		{"本地删除而对方修改", files(), files("a", "2"), files("a", "1"), SyncDownload},
+		{"对方删除而本地修改", files("a", "2"), files(), files("a", "1"), SyncUpload},
+	}
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, tt := range tests {
+		plan := planSync(tt.local, tt.remote, tt.base, now)
+		if tt.action == "" {
+			if len(plan.Changes) != 0 {
+				t.Errorf("%s: 计划 = %+v，应无变更", tt.name, plan.Changes)
+			}
+			continue
+		}
+		if len(plan.Changes) != 1 || plan.Changes[0].Path != "a" || plan.Changes[0].Action != tt.action {
+			t.Errorf("%s: 计划 = %+v，应为 %s", tt.name, plan.Changes, tt.action)
+			continue
+		}
+		l, r := tt.local["a"].Size, tt.remote["a"].Size
+		var up, down int64
+		switch tt.action {
+		case SyncUpload:
+			up = l
+		case SyncDownload:
+			down = r
+		case SyncConflict:
+			up, down = l, r
+			if got := plan.Changes[0].ConflictPath; got != "a (conflict 20240102-150405)" {
+				t.Errorf("%s: 冲突副本 = %q", tt.name, got)
+			}
+		}
+		if plan.UploadBytes != up || plan.DownloadBytes != down {
+			t.Errorf("%s: 上传 %d 下载 %d，应为 %d 和 %d", tt.name, plan.UploadBytes, plan.DownloadBytes, up, down)
+		}
+	}
+}
+
+func TestConflictPathAvoidsExisting(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	taken := map[string]bool{"dir/a (conflict 20240102-150405).txt": true}
+	got := conflictPath("dir/a.txt", now, func(p string) bool { return taken[p] })
+	if got != "dir/a (conflict 20240102-150405 2).txt" {
+		t.Errorf("conflictPath = %q", got)
+	}
+}
+
+// 冲突时双方都保留两个版本，删除双向传播
+func TestSyncConflictAndDeletes(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "docs")
+	dest := t.TempDir()
+	remote := filepath.Join(dest, "docs")
+	writeTree(t, local, map[string]string{"a.txt": "1", "b.txt": "b", "sub/c.txt": "c", "same.txt": "s"})
+
+	runSync := func() SyncPlan {
+		t.Helper()
+		plan, syncErr, recvErr := syncLoopback(t, &Syncer{Dir: local}, &Receiver{Dir: dest, AllowSync: true})
+		if syncErr != nil || recvErr != nil {
+			t.Fatalf("发起端: %v, 接收端: %v", syncErr, recvErr)
+		}
+		return plan
+	}
+	if plan := runSync(); len(plan.Changes) != 4 {
+		t.Fatalf("首次同步 = %+v", plan.Changes)
+	}
+
+	writeTree(t, local, map[string]string{"a.txt": "local"})
+	writeTree(t, remote, map[string]string{"a.txt": "remote!"})
+	if err := os.Remove(filepath.Join(local, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(remote, "sub", "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := runSync()
+	actions := make(map[string]SyncChange)
+	for _, c := range plan.Changes {
+		actions[c.Path] = c
+	}
+	if len(plan.Changes) != 3 || actions["a.txt"].Action != SyncConflict ||
+		actions["b.txt"].Action != SyncDeleteRemote || actions["sub/c.txt"].Action != SyncDeleteLocal {
+		t.Fatalf("计划 = %+v", plan.Changes)
+	}
+
+	copyName := actions["a.txt"].ConflictPath
+	for _, root := range []string{local, remote} {
+		want := map[string]string{"a.txt": "local", copyName: "remote!", "same.txt": "s"}
+		for rel, content := range want {
+			if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel))); err != nil || string(data) != content {
+				t.Errorf("%s/%s = %q, %v，应为 %q", root, rel, data, err, content)
+			}
+		}
+		for _, rel := range []string{"b.txt", "sub/c.txt"} {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); !os.IsNotExist(err) {
+				t.Errorf("%s/%s 应已删除", root, rel)
+			}
+		}
+	}
+
+	// 双方一致后再次同步无变更
+	if plan := runSync(); len(plan.Changes) != 0 {
+		t.Errorf("再次同步 = %+v", plan.Changes)
+	}
+}
@@ -0,0 +1,149 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// --------------------------- 文本消息 ---------------------------
+// 发送端连接接收端后直接发送文本，不经过清单和文件流：
+//
+//	TEXT|字节数
+//	<UTF-8 文本>
+//
+// 接收端答复 ACCEPT，或 REJECT|原因（如超过 TextLimit）。旧版接收端会直接断开连接。
+const (
+	TextMarker = "TEXT"
+	TextLimit  = 1024 * 1024 // 单条文本消息的最大字节数
+)
+
+// TextMessage 为一条收到的文本消息
+type TextMessage struct {
+	Peer     string    `json:"peer"`     // 发送端地址
+	Text     string    `json:"text"`     // 文本内容
+	Received time.Time `json:"received"` // 收到的时间
+}
+
+// TextObserver 接收文本消息。回调在接收所在的 goroutine 中同步执行，实现不应阻塞。
+type TextObserver interface {
+	TextReceived(msg TextMessage)
+}
+
+// validateText 检查文本能否作为一条消息发送
+func validateText(text string) error {
+	if text == "" {
+		return fmt.Errorf("文本为空")
+	}
+	if len(text) > TextLimit {
+		return fmt.Errorf("文本过长: %s，上限 %s", FormatFileSize(int64(len(text))), FormatFileSize(TextLimit))
+	}
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("文本不是有效的 UTF-8")
+	}
+	return nil
+}
+
+// SendText 将 text 作为一条文本消息发送到 target，target 为空时通过广播自动发现接收端
+func (s *Sender) SendText(text, target string) (err error) {
+	s.sess = newSession(s.Observer, s.Limiters)
+	defer func() {
+		if err != nil && s.isCanceled() {
+			err = ErrCanceled
+		}
+		if err != nil {
+			s.sess.fail(err)
+		}
+	}()
+
+	if err = validateText(text); err != nil {
+		return err
+	}
+	if target == "" {
+		if target, err = (&Discoverer{}).FindFirst(); err != nil {
+			return fmt.Errorf("发现接收端失败: %v", err)
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", receiverAddr(target), TimeoutDuration)
+	if err != nil {
+		return fmt.Errorf("连接接收端失败: %v", err)
+	}
+	defer conn.Close()
+	if err = s.attach(conn); err != nil {
+		return err
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(TimeoutDuration))
+	if _, err = fmt.Fprintf(conn, "%s|%d\n%s", TextMarker, len(text), text); err != nil {
+		return fmt.Errorf("发送文本失败: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(TimeoutDuration))
+	reply, err := readRawLine(conn)
+	if err != nil {
+		return fmt.Errorf("接收端未确认，可能不支持文本消息: %v", err)
+	}
+	if reason, ok := strings.CutPrefix(reply, RejectMarker+"|"); ok {
+		return fmt.Errorf("接收端拒绝文本: %s", reason)
+	}
+
+	s.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+	})
+	s.sess.status("文本已发送")
+	return nil
+}
+
+// isTextRequest 判断连接是否以文本消息开头。
+// 单个根名为 TEXT 时旧格式清单为 "TEXT|FILE" 或 "TEXT|DIR"，以字节数的首位数字区分。
+func isTextRequest(reader *bufio.Reader) bool {
+	head, err := reader.Peek(len(TextMarker) + 2)
+	if err != nil || string(head[:len(TextMarker)+1]) != TextMarker+"|" {
+		return false
+	}
+	c := head[len(TextMarker)+1]
+	return c >= '0' && c <= '9'
+}
+
+// receiveText 读取一条文本消息并通知 TextObserver
+func (r *Receiver) receiveText(conn net.Conn, reader *bufio.Reader) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("读取文本失败: %v", err)
+	}
+	size, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(line), TextMarker+"|"))
+	if err != nil || size <= 0 {
+		return fmt.Errorf("文本消息格式错误")
+	}
+	if size > TextLimit {
+		conn.Write([]byte(fmt.Sprintf("%s|文本超过 %s\n", RejectMarker, FormatFileSize(TextLimit))))
+		return fmt.Errorf("已拒绝文本: 超过 %s", FormatFileSize(TextLimit))
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return fmt.Errorf("读取文本失败: %v", err)
+	}
+	if !utf8.Valid(buf) {
+		conn.Write([]byte(RejectMarker + "|文本不是有效的 UTF-8\n"))
+		return fmt.Errorf("已拒绝文本: 不是有效的 UTF-8")
+	}
+	conn.Write([]byte(AcceptMarker + "\n"))
+
+	peer, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	msg := TextMessage{Peer: peer, Text: string(buf), Received: time.Now()}
+	if r.TextObserver != nil {
+		r.TextObserver.TextReceived(msg)
+	}
+	r.sess.update(func(st *Stats) {
+		st.Status = "completed"
+		st.Progress = 100
+	})
+	r.sess.status(fmt.Sprintf("已收到来自 %s 的文本（%d 个字符）", peer, utf8.RuneCount(buf)))
+	return nil
+}
@@ -0,0 +1,116 @@
+package transfer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateText(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{"你好", true},
+		{strings.Repeat("a", TextLimit), true},
+		{"", false},
+		{strings.Repeat("a", TextLimit+1), false},
+		{"\xff\xfe", false},
+	}
+	for _, tt := range tests {
+		if err := validateText(tt.text); (err == nil) != tt.ok {
+			t.Errorf("validateText(%d 字节) = %v", len(tt.text), err)
+		}
+	}
+}
+
+func TestSendTextRoundTrip(t *testing.T) {
+	var got []TextMessage
+	r := &Receiver{Dir: t.TempDir(), TextObserver: textRecorder(func(m TextMessage) { got = append(got, m) })}
+	addr, done := serveOnce(t, r)
+
+	text := "第一行\n第二行|带分隔符"
+	if err := (&Sender{}).SendText(text, addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Text != text || got[0].Peer != "127.0.0.1" {
+		t.Errorf("收到 %+v", got)
+	}
+}
+
+// 发送端在连接之前拒绝过长的文本
+func TestSendTextTooLong(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- struct{}{}
+			conn.Close()
+		}
+	}()
+	if err := (&Sender{}).SendText(strings.Repeat("a", TextLimit+1), ln.Addr().String()); err == nil {
+		t.Fatal("过长的文本应被拒绝")
+	}
+	select {
+	case <-accepted:
+		t.Error("过长的文本不应建立连接")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// 接收端对超过上限或无效的文本答复 REJECT，且不通知观察者
+func TestReceiveTextRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+	}{
+		{"超过上限", TextMarker + "|" + strconv.Itoa(TextLimit+1) + "\n"},
+		{"无效的 UTF-8", TextMarker + "|2\n\xff\xfe"},
+	}
+	for _, tt := range tests {
+		var got []TextMessage
+		r := &Receiver{Dir: t.TempDir(), TextObserver: textRecorder(func(m TextMessage) { got = append(got, m) })}
+		addr, done := serveOnce(t, r)
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(tt.request))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err != nil || !strings.HasPrefix(reply, RejectMarker+"|") {
+			t.Errorf("%s: 答复 %q, %v，应为 REJECT", tt.name, reply, err)
+		}
+		if err := <-done; err == nil {
+			t.Errorf("%s: 接收端应报错", tt.name)
+		}
+		if len(got) != 0 {
+			t.Errorf("%s: 不应通知观察者: %+v", tt.name, got)
+		}
+	}
+}
+
+// 名为 TEXT 的单个文件仍按旧格式清单接收，不被当作文本消息
+func TestTextNamedRootIsNotMessage(t *testing.T) {
+	dest := t.TempDir()
+	stream := TextMarker + "|FILE\n" + StatsMarker + "|1|2\n" + FileHeaderPrefix + "|TEXT|2\nhi" + EndMarker + "\n"
+	if err := receiveRaw(t, &Receiver{Dir: dest}, stream); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "TEXT")); string(data) != "hi" {
+		t.Errorf("TEXT = %q", data)
+	}
+}
@@ -0,0 +1,81 @@
+// Package transfer 实现局域网文件传输的发现、发送与接收，不依赖任何界面框架。
+// 进度和状态通过 Observer 回调通知调用方，图形界面和命令行分别将其转换为事件或终端输出。
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// --------------------------- 配置常量 ---------------------------
+const (
+	DefaultPort           = 60001
+	DiscoveryPort         = 60002
+	DiscoveryResponsePort = 60003
+	BufferSize            = 1024 * 1024 * 16
+	TimeoutDuration       = 60 * time.Second
+	DiscoveryMessage      = "GO_FILE_TRANSFER_DISCOVERY_REQUEST"
+	DiscoveryResponse     = "GO_FILE_TRANSFER_DISCOVERY_RESPONSE"
+	FileHeaderPrefix      = "FILE_START"
+	EndMarker             = "TRANSFER_END"
+	StatsMarker           = "STATS_INFO" // 统计信息标记
+)
+
+// ErrCanceled 表示传输被调用方取消
+var ErrCanceled = errors.New("传输已取消")
+
+// --------------------------- 传输统计结构体 ---------------------------
+type Stats struct {
+	TotalFiles       int     `json:"totalFiles"`       // 总文件数
+	CompletedFiles   int     `json:"completedFiles"`   // 已完成文件数
+	TotalBytes       int64   `json:"totalBytes"`       // 总字节数
+	TransferredBytes int64   `json:"transferredBytes"` // 已传输字节数
+	CurrentSpeed     float64 `json:"currentSpeed"`     // 当前传输速度 (MB/s)
+	EstimatedTime    string  `json:"estimatedTime"`    // 预计剩余时间
+	CurrentFile      string  `json:"currentFile"`      // 当前传输的文件名
+	Progress         float64 `json:"progress"`         // 总体进度百分比 (0-100)
+	Status           string  `json:"status"`           // 传输状态: "scanning", "transferring", "completed", "failed"
+	RateLimit        float64 `json:"rateLimit"`        // 当前生效的限速 (MB/s)，0 表示不限速
+	Throttled        bool    `json:"throttled"`        // 是否正在因限速而等待
+	SavedBytes       int64   `json:"savedBytes"`       // 差异传输和去重节省的传输字节数
+}
+
+// --------------------------- 观察者接口 ---------------------------
+// Observer 接收传输过程中的状态文字和统计信息。
+// 回调在传输所在的 goroutine 中同步执行，实现不应阻塞，也不应回调发送端或接收端。
+type Observer interface {
+	StatusChanged(status string)
+	StatsUpdated(stats Stats)
+}
+
+// nopObserver 在调用方未提供观察者时丢弃所有通知
+type nopObserver struct{}
+
+func (nopObserver) StatusChanged(string) {}
+func (nopObserver) StatsUpdated(Stats)   {}
+
+func observerOrNop(o Observer) Observer {
+	if o == nil {
+		return nopObserver{}
+	}
+	return o
+}
+
+// --------------------------- 工具函数 ---------------------------
+// FormatFileSize 格式化文件大小显示
+func FormatFileSize(bytes int64) string {
+	if bytes == 0 {
+		return "0 B"
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,82 @@
+package transfer
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+// sendLoopback 在 127.0.0.1 的随机端口上由 r 接收 s 发送的 paths，保存到 r.Dir，返回双方的错误。
+// wrap 不为 nil 时用于包装双方的连接。
+func sendLoopback(tb testing.TB, s *Sender, r *Receiver, paths []string, wrap func(net.Conn) net.Conn) (sendErr, recvErr error) {
+	tb.Helper()
+	if wrap == nil {
+		wrap = func(c net.Conn) net.Conn { return c }
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		r.sess = newSession(r.Observer, r.Limiters)
+		done <- r.serve(wrap(conn), r.Dir)
+	}()
+
+	roots, err := buildSendRoots(paths)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s.sess = newSession(s.Observer, s.Limiters)
+	sendErr = s.sendOver(roots, func() (net.Conn, error) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		return wrap(conn), nil
+	})
+	return sendErr, <-done
+}
+
+// receiveRaw 在回环连接上由 r 接收原样写出的 stream，模拟构造的发送端，返回接收端的错误
+func receiveRaw(tb testing.TB, r *Receiver, stream string) error {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		r.sess = newSession(r.Observer, r.Limiters)
+		done <- r.serve(conn, r.Dir)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	if _, err := io.WriteString(conn, stream); err != nil {
+		tb.Fatal(err)
+	}
+	// 构造的发送端没有更多数据，半关闭连接使接收端读到结尾而不是等待超时
+	conn.(*net.TCPConn).CloseWrite()
+	return <-done
+}
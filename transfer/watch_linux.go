@@ -0,0 +1,142 @@
+//go:build linux
+
+package transfer
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask 为监视目录时关注的事件：新建、写入完成、移入和修改
+const inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MODIFY
+
+// inotifySource 通过 inotify 递归监视目录，新建或移入的子目录会自动加入监视
+type inotifySource struct {
+	fd     int
+	file   *os.File
+	root   string
+	events chan string
+	done   chan struct{}
+
+	mu   sync.Mutex
+	dirs map[int]string // 监视描述符对应的目录（相对监视目录）
+}
+
+func newChangeSource(root string) (changeSource, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	s := &inotifySource{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		root:   root,
+		events: make(chan string, 256),
+		done:   make(chan struct{}),
+		dirs:   make(map[int]string),
+	}
+	if err := s.addTree(""); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	go s.read()
+	return s, nil
+}
+
+func (s *inotifySource) Events() <-chan string {
+	return s.events
+}
+
+func (s *inotifySource) Close() error {
+	close(s.done)
+	return s.file.Close()
+}
+
+// addTree 监视 rel 及其所有子目录，子目录监视失败时跳过
+func (s *inotifySource) addTree(rel string) error {
+	dir := filepath.Join(s.root, filepath.FromSlash(rel))
+	wd, err := unix.InotifyAddWatch(s.fd, dir, inotifyMask|unix.IN_ONLYDIR)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dirs[wd] = rel
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			s.addTree(path.Join(rel, e.Name()))
+		}
+	}
+	return nil
+}
+
+// read 读取 inotify 事件并转换为变化的路径，直到关闭
+func (s *inotifySource) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := s.file.Read(buf)
+		if err != nil {
+			close(s.events)
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[start:start+nameLen]), "\x00")
+			off = start + nameLen
+
+			if !s.handle(wd, mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handle 处理一个事件，监视已关闭时返回 false
+func (s *inotifySource) handle(wd int, mask uint32, name string) bool {
+	var rel string
+	switch {
+	case mask&unix.IN_Q_OVERFLOW != 0:
+		// 事件队列溢出，改为重新扫描整个目录
+		rel = ""
+	case mask&unix.IN_IGNORED != 0:
+		s.mu.Lock()
+		delete(s.dirs, wd)
+		s.mu.Unlock()
+		return true
+	default:
+		s.mu.Lock()
+		dir, ok := s.dirs[wd]
+		s.mu.Unlock()
+		if !ok || name == "" {
+			return true
+		}
+		rel = path.Join(dir, name)
+		if mask&unix.IN_ISDIR != 0 {
+			if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) == 0 {
+				return true
+			}
+			s.addTree(rel)
+		}
+	}
+
+	select {
+	case s.events <- rel:
+		return true
+	case <-s.done:
+		return false
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !linux
+
+package transfer
+
+import "time"
+
+// watchPollInterval 为不支持 inotify 的平台上重新扫描目录的间隔
+const watchPollInterval = 2 * time.Second
+
+// pollSource 定期请求重新扫描整个目录，由监视循环比较文件的大小和修改时间
+type pollSource struct {
+	events chan string
+	done   chan struct{}
+}
+
+func newChangeSource(root string) (changeSource, error) {
+	s := &pollSource{events: make(chan string), done: make(chan struct{})}
+	go s.poll()
+	return s, nil
+}
+
+func (s *pollSource) Events() <-chan string {
+	return s.events
+}
+
+func (s *pollSource) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *pollSource) poll() {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			select {
+			case s.events <- "":
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
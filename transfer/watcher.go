@@ -0,0 +1,412 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- 监视目录自动发送 ---------------------------
+const (
+	DefaultWatchDebounce = 2 * time.Second        // 文件停止变化后等待多久再发送
+	watchTick            = 250 * time.Millisecond // 检查待发送文件的间隔
+	watchRetryMin        = 5 * time.Second        // 发送失败后的首次重试间隔
+	watchRetryMax        = 5 * time.Minute        // 重试间隔上限
+)
+
+// WatchStatus 为监视目录的当前状态
+type WatchStatus struct {
+	Dir       string    `json:"dir"`       // 监视的目录
+	Target    string    `json:"target"`    // 接收端地址，为空表示自动发现
+	Watching  bool      `json:"watching"`  // 是否正在监视
+	Pending   int       `json:"pending"`   // 等待发送的文件数
+	Sending   bool      `json:"sending"`   // 是否正在发送
+	SentFiles int       `json:"sentFiles"` // 本次监视以来已发送的文件数
+	Message   string    `json:"message"`   // 最近的状态文字
+	LastError string    `json:"lastError"` // 最近一次发送失败的原因，成功后清空
+	NextRetry time.Time `json:"nextRetry"` // 失败后下次重试的时间
+	Stats     Stats     `json:"stats"`     // 当前或最近一次发送的统计信息
+}
+
+// WatchObserver 接收监视目录的状态变化，回调可能来自监视或发送所在的 goroutine，实现不应阻塞
+type WatchObserver interface {
+	WatchStatusChanged(status WatchStatus)
+}
+
+// Watcher 监视本地文件夹，将新增或修改的文件在停止变化后自动发送到接收端。
+// 文件以监视目录为发送根，在接收端保存为 "目录名/相对路径"。
+// 发送失败时保留在队列中并按指数退避重试；设置 QueueFile 后队列和已发送记录写入该文件，
+// 重新启动时继续发送未完成的文件，并补发停止监视期间发生变化的文件。
+// 首次监视某个目录时，目录中已有的文件视为已发送。
+type Watcher struct {
+	Dir       string         // 监视的目录
+	Target    string         // 接收端地址，为空时每次发送前自动发现
+	Options   SendOptions    // 过滤选项，被排除的文件不会发送
+	QueueFile string         // 队列文件路径，为空时不持久化
+	Debounce  time.Duration  // 文件停止变化后等待的时间，0 使用 DefaultWatchDebounce
+	Observer  WatchObserver  // 状态观察者，可为 nil
+	Limiters  []*RateLimiter // 发送时依次申请令牌的令牌桶
+
+	mu     sync.Mutex
+	status WatchStatus
+}
+
+// fileStamp 用大小和修改时间判断文件是否变化
+type fileStamp struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"modTime"`
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+// watchState 为写入队列文件的内容
+type watchState struct {
+	Dir     string               `json:"dir"`
+	Sent    map[string]fileStamp `json:"sent"`    // 已发送文件的版本
+	Pending []string             `json:"pending"` // 等待发送的文件
+}
+
+// pendingFile 为队列中的一个文件
+type pendingFile struct {
+	stamp   fileStamp
+	changed time.Time // 最近一次观察到变化的时间
+}
+
+// sendResult 为一批文件的发送结果
+type sendResult struct {
+	files map[string]fileStamp
+	count int // 实际发送的文件数，不含被过滤规则排除的文件
+	err   error
+}
+
+// Status 返回监视目录的当前状态
+func (w *Watcher) Status() WatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// setStatus 修改状态并通知观察者
+func (w *Watcher) setStatus(fn func(st *WatchStatus)) {
+	w.mu.Lock()
+	fn(&w.status)
+	st := w.status
+	w.mu.Unlock()
+	if w.Observer != nil {
+		w.Observer.WatchStatusChanged(st)
+	}
+}
+
+// watchSendObserver 将每次发送的进度并入监视状态
+type watchSendObserver struct {
+	w *Watcher
+}
+
+func (o watchSendObserver) StatusChanged(status string) {
+	o.w.setStatus(func(st *WatchStatus) { st.Message = status })
+}
+
+func (o watchSendObserver) StatsUpdated(stats Stats) {
+	o.w.setStatus(func(st *WatchStatus) { st.Stats = stats })
+}
+
+// Run 开始监视，阻塞到 quit 关闭。进行中的发送会被取消，未发送的文件保留在队列中。
+func (w *Watcher) Run(quit <-chan struct{}) error {
+	dir, err := filepath.Abs(w.Dir)
+	if err != nil {
+		return fmt.Errorf("无效的监视目录: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("监视目录不存在: %v", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("监视的路径不是文件夹: %s", dir)
+	}
+	filter, err := NewFilter(w.Options)
+	if err != nil {
+		return err
+	}
+	debounce := w.Debounce
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	src, err := newChangeSource(dir)
+	if err != nil {
+		return fmt.Errorf("监视目录失败: %v", err)
+	}
+	defer src.Close()
+
+	l := &watchLoop{w: w, dir: dir, filter: filter, debounce: debounce, pending: make(map[string]*pendingFile)}
+	l.load()
+
+	w.setStatus(func(st *WatchStatus) {
+		*st = WatchStatus{Dir: dir, Target: w.Target, Watching: true, Message: "正在监视: " + dir}
+	})
+	l.publish()
+	defer w.setStatus(func(st *WatchStatus) {
+		st.Watching = false
+		st.Sending = false
+		st.Message = "已停止监视"
+	})
+
+	tick := time.NewTicker(watchTick)
+	defer tick.Stop()
+	results := make(chan sendResult, 1)
+	var active *Sender
+
+	for {
+		select {
+		case <-quit:
+			if active != nil {
+				active.Cancel()
+				l.finishSend(<-results)
+			}
+			return nil
+		case rel, ok := <-src.Events():
+			if !ok {
+				return fmt.Errorf("监视目录失败: 事件源已关闭")
+			}
+			l.changed(rel)
+		case res := <-results:
+			active = nil
+			l.finishSend(res)
+		case now := <-tick.C:
+			if active == nil && !now.Before(l.nextRetry) {
+				active = l.startSend(now, results)
+			}
+		}
+	}
+}
+
+// --------------------------- 监视循环 ---------------------------
+type watchLoop struct {
+	w        *Watcher
+	dir      string
+	filter   *Filter
+	debounce time.Duration
+
+	sent      map[string]fileStamp
+	pending   map[string]*pendingFile
+	retry     time.Duration
+	nextRetry time.Time
+}
+
+// load 读取队列文件。文件不存在或属于其他目录时，将目录中现有文件视为已发送。
+func (l *watchLoop) load() {
+	var state watchState
+	if l.w.QueueFile != "" {
+		if data, err := os.ReadFile(l.w.QueueFile); err == nil {
+			if json.Unmarshal(data, &state) != nil || state.Dir != l.dir {
+				state = watchState{}
+			}
+		}
+	}
+
+	if state.Sent == nil {
+		l.sent = make(map[string]fileStamp)
+		l.walk("", func(rel string, info os.FileInfo) { l.sent[rel] = stampOf(info) })
+		l.save()
+		return
+	}
+
+	l.sent = state.Sent
+	earlier := time.Now().Add(-l.debounce)
+	for _, rel := range state.Pending {
+		if info, err := os.Stat(l.abs(rel)); err == nil && info.Mode().IsRegular() {
+			l.pending[rel] = &pendingFile{stamp: stampOf(info), changed: earlier}
+		}
+	}
+	// 补发停止监视期间变化的文件，并清理已删除文件的记录
+	l.changed("")
+}
+
+// save 将已发送记录和队列写入队列文件
+func (l *watchLoop) save() {
+	if l.w.QueueFile == "" {
+		return
+	}
+	state := watchState{Dir: l.dir, Sent: l.sent, Pending: make([]string, 0, len(l.pending))}
+	for rel := range l.pending {
+		state.Pending = append(state.Pending, rel)
+	}
+	sort.Strings(state.Pending)
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = writeFileAtomic(l.w.QueueFile, data)
+	}
+	if err != nil {
+		l.w.setStatus(func(st *WatchStatus) { st.Message = fmt.Sprintf("保存发送队列失败: %v", err) })
+	}
+}
+
+func (l *watchLoop) abs(rel string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(rel))
+}
+
+// walk 按过滤规则遍历 rel 下的普通文件，rel 为空时遍历整个监视目录
+func (l *watchLoop) walk(rel string, fn func(rel string, info os.FileInfo)) {
+	root := l.abs(rel)
+	l.filter.walk(root, "", func(fullPath, walkRel string, info os.FileInfo) error {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		// walk 返回的路径以根目录名开头，换算为相对监视目录的路径
+		sub := walkRel[len(filepath.Base(root)):]
+		fn(strings.TrimPrefix(path.Join(rel, sub), "/"), info)
+		return nil
+	})
+}
+
+// changed 处理一个变化的文件或目录，rel 为空时重新扫描整个目录
+func (l *watchLoop) changed(rel string) {
+	now := time.Now()
+	seen := make(map[string]bool)
+	dirty := false // 队列或已发送记录是否变化，只有变化时才写入队列文件
+	l.walk(rel, func(rel string, info os.FileInfo) {
+		seen[rel] = true
+		stamp := stampOf(info)
+		if p, ok := l.pending[rel]; ok {
+			if p.stamp != stamp {
+				p.stamp, p.changed = stamp, now
+			}
+			return
+		}
+		if sent, ok := l.sent[rel]; ok && sent == stamp {
+			return
+		}
+		l.pending[rel] = &pendingFile{stamp: stamp, changed: now}
+		dirty = true
+	})
+	if rel == "" {
+		for r := range l.sent {
+			if !seen[r] {
+				delete(l.sent, r)
+				dirty = true
+			}
+		}
+		for r := range l.pending {
+			if !seen[r] {
+				delete(l.pending, r)
+				dirty = true
+			}
+		}
+	}
+	if dirty {
+		l.save()
+		l.publish()
+	}
+}
+
+// publish 更新状态中的待发送文件数
+func (l *watchLoop) publish() {
+	n := len(l.pending)
+	l.w.setStatus(func(st *WatchStatus) { st.Pending = n })
+}
+
+// startSend 发送已停止变化的文件，没有可发送的文件时返回 nil
+func (l *watchLoop) startSend(now time.Time, results chan<- sendResult) *Sender {
+	ready := make(map[string]fileStamp)
+	for rel, p := range l.pending {
+		if now.Sub(p.changed) < l.debounce {
+			continue
+		}
+		info, err := os.Stat(l.abs(rel))
+		if err != nil || !info.Mode().IsRegular() {
+			delete(l.pending, rel)
+			continue
+		}
+		// 仍在写入的文件推迟到下一次检查
+		if stamp := stampOf(info); stamp != p.stamp {
+			p.stamp, p.changed = stamp, now
+			continue
+		}
+		ready[rel] = p.stamp
+	}
+	if len(ready) == 0 {
+		return nil
+	}
+
+	rels := make([]string, 0, len(ready))
+	for rel := range ready {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	filter := l.filter.restrictTo(rels)
+
+	// 全部被过滤规则排除时不建立会话，直接视为已发送
+	count, _, err := ScanFiles(l.dir, filter)
+	if err == nil && count == 0 {
+		l.finishSend(sendResult{files: ready})
+		return nil
+	}
+
+	sender := &Sender{Filter: filter, Observer: watchSendObserver{l.w}, Limiters: l.w.Limiters, Delta: l.w.Options.Delta, Dedup: l.w.Options.Dedup, Archive: l.w.Options.Archive}
+	l.w.setStatus(func(st *WatchStatus) {
+		st.Sending = true
+		st.Message = fmt.Sprintf("正在发送 %d 个文件...", count)
+	})
+	go func() {
+		err := sender.Send([]string{l.dir}, l.w.Target)
+		results <- sendResult{files: ready, count: count, err: err}
+	}()
+	return sender
+}
+
+// finishSend 根据发送结果更新队列，失败时安排重试
+func (l *watchLoop) finishSend(res sendResult) {
+	if res.err != nil {
+		l.retry *= 2
+		if l.retry < watchRetryMin {
+			l.retry = watchRetryMin
+		}
+		if l.retry > watchRetryMax {
+			l.retry = watchRetryMax
+		}
+		l.nextRetry = time.Now().Add(l.retry)
+		retry, next := l.retry, l.nextRetry
+		l.w.setStatus(func(st *WatchStatus) {
+			st.Sending = false
+			st.LastError = res.err.Error()
+			st.NextRetry = next
+			st.Message = fmt.Sprintf("发送失败，%v 后重试: %v", retry, res.err)
+		})
+		return
+	}
+
+	// 发送期间又发生变化的文件留在队列中
+	for rel, stamp := range res.files {
+		l.sent[rel] = stamp
+		if p, ok := l.pending[rel]; ok && p.stamp == stamp {
+			delete(l.pending, rel)
+		}
+	}
+	l.retry = 0
+	l.nextRetry = time.Time{}
+	l.save()
+	n, sent := len(l.pending), res.count
+	l.w.setStatus(func(st *WatchStatus) {
+		st.Sending = false
+		st.Pending = n
+		st.SentFiles += sent
+		st.LastError = ""
+		st.NextRetry = time.Time{}
+		if sent > 0 {
+			st.Message = fmt.Sprintf("已发送 %d 个文件", sent)
+		}
+	})
+}
+
+// --------------------------- 变化来源 ---------------------------
+// changeSource 报告监视目录中变化的路径（相对监视目录的斜杠路径），空字符串表示需要重新扫描整个目录
+type changeSource interface {
+	Events() <-chan string
+	Close() error
+}
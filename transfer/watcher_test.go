@@ -0,0 +1,198 @@
+package transfer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestWatchLoop(t *testing.T, dir, queueFile string) *watchLoop {
+	t.Helper()
+	filter, err := NewFilter(SendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &watchLoop{
+		w:        &Watcher{Dir: dir, QueueFile: queueFile},
+		dir:      dir,
+		filter:   filter,
+		debounce: time.Second,
+		pending:  make(map[string]*pendingFile),
+	}
+}
+
+// closedAddr 返回一个没有监听的回环地址
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// 文件在停止变化 debounce 之后才发送，仍在写入的文件推迟
+func TestWatchDebounce(t *testing.T) {
+	dir := t.TempDir()
+	l := newTestWatchLoop(t, dir, "")
+	l.load()
+	l.w.Target = closedAddr(t)
+
+	writeTree(t, dir, map[string]string{"a.txt": "a"})
+	l.changed("a.txt")
+	p := l.pending["a.txt"]
+	if p == nil {
+		t.Fatal("新文件未加入队列")
+	}
+	results := make(chan sendResult, 1)
+	if s := l.startSend(p.changed.Add(l.debounce/2), results); s != nil {
+		t.Fatal("文件仍在变化期内时不应发送")
+	}
+
+	// 检查时发现文件又变了，重新计时
+	writeTree(t, dir, map[string]string{"a.txt": "aa"})
+	later := p.changed.Add(l.debounce)
+	if s := l.startSend(later, results); s != nil {
+		t.Fatal("仍在写入的文件不应发送")
+	}
+	if !p.changed.Equal(later) {
+		t.Errorf("变化时间 = %v，应为 %v", p.changed, later)
+	}
+
+	s := l.startSend(later.Add(l.debounce), results)
+	if s == nil {
+		t.Fatal("停止变化后应开始发送")
+	}
+	res := <-results
+	if res.err == nil || len(res.files) != 1 {
+		t.Fatalf("发送到不可达的接收端: %+v", res)
+	}
+	l.finishSend(res)
+	if l.pending["a.txt"] == nil {
+		t.Error("发送失败的文件应留在队列中")
+	}
+}
+
+func TestWatchRetryBackoff(t *testing.T) {
+	l := newTestWatchLoop(t, t.TempDir(), "")
+	l.load()
+	fail := sendResult{err: errors.New("连接失败")}
+
+	want := watchRetryMin
+	for i := 0; i < 10; i++ {
+		before := time.Now()
+		l.finishSend(fail)
+		if l.retry != want {
+			t.Fatalf("第 %d 次失败后等待 %v，应为 %v", i+1, l.retry, want)
+		}
+		if l.nextRetry.Before(before.Add(want)) {
+			t.Errorf("下次重试时间 %v 早于 %v", l.nextRetry, before.Add(want))
+		}
+		want = min(want*2, watchRetryMax)
+	}
+	if st := l.w.Status(); st.LastError == "" || st.NextRetry.IsZero() {
+		t.Errorf("失败状态 = %+v", st)
+	}
+
+	l.finishSend(sendResult{})
+	if l.retry != 0 || !l.nextRetry.IsZero() || l.w.Status().LastError != "" {
+		t.Error("发送成功后应重置重试间隔")
+	}
+	l.finishSend(fail)
+	if l.retry != watchRetryMin {
+		t.Errorf("成功后再次失败等待 %v，应为 %v", l.retry, watchRetryMin)
+	}
+}
+
+// 重新启动时继续发送队列中的文件，补发停止期间变化的文件，清理已删除文件的记录
+func TestWatchQueueReload(t *testing.T) {
+	dir := t.TempDir()
+	queueFile := filepath.Join(t.TempDir(), "watch.json")
+	writeTree(t, dir, map[string]string{"old.txt": "o", "gone.txt": "g", "sub/keep.txt": "k"})
+
+	l := newTestWatchLoop(t, dir, queueFile)
+	l.load()
+	if len(l.pending) != 0 || len(l.sent) != 3 {
+		t.Fatalf("首次监视时已有的文件应视为已发送: pending %d, sent %d", len(l.pending), len(l.sent))
+	}
+	writeTree(t, dir, map[string]string{"queued.txt": "q"})
+	l.changed("queued.txt")
+
+	// 停止监视期间的变化
+	writeTree(t, dir, map[string]string{"old.txt": "changed", "sub/new.txt": "n"})
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestWatchLoop(t, dir, queueFile)
+	reloaded.load()
+	for _, rel := range []string{"queued.txt", "old.txt", "sub/new.txt"} {
+		if reloaded.pending[rel] == nil {
+			t.Errorf("%s 应在队列中", rel)
+		}
+	}
+	if len(reloaded.pending) != 3 {
+		t.Errorf("队列中有 %d 个文件，应为 3", len(reloaded.pending))
+	}
+	if _, ok := reloaded.sent["gone.txt"]; ok {
+		t.Error("已删除文件的记录未清理")
+	}
+	if _, ok := reloaded.sent["sub/keep.txt"]; !ok {
+		t.Error("未变化文件的记录丢失")
+	}
+	// 上次留在队列中的文件无需再等待 debounce
+	if p := reloaded.pending["queued.txt"]; time.Since(p.changed) < reloaded.debounce {
+		t.Error("重新载入的队列文件应可立即发送")
+	}
+
+	// 队列文件属于其他目录时忽略
+	other := newTestWatchLoop(t, t.TempDir(), queueFile)
+	other.load()
+	if len(other.pending) != 0 {
+		t.Errorf("其他目录的队列被载入: %d 个文件", len(other.pending))
+	}
+}
+
+// 监视开始后新建的文件在停止变化后发送到接收端
+func TestWatcherSendsNewFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "watched")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	addr, done := serveOnce(t, &Receiver{Dir: dest})
+
+	w := &Watcher{Dir: dir, Target: addr, Debounce: 50 * time.Millisecond}
+	quit := make(chan struct{})
+	stopped := make(chan error, 1)
+	go func() { stopped <- w.Run(quit) }()
+	defer func() {
+		close(quit)
+		if err := <-stopped; err != nil {
+			t.Error(err)
+		}
+	}()
+	for deadline := time.Now().Add(5 * time.Second); !w.Status().Watching; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("未开始监视")
+		}
+	}
+
+	writeTree(t, dir, map[string]string{"new.txt": "fresh"})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("新文件未被发送")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "watched", "new.txt")); string(data) != "fresh" {
+		t.Errorf("new.txt = %q", data)
+	}
+}
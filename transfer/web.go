@@ -0,0 +1,420 @@
+package transfer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --------------------------- 浏览器传输 ---------------------------
+// 未安装本应用的设备可通过浏览器上传或下载文件。所有请求都需携带访问令牌 t，
+// 上传按块提交到隐藏的临时文件，中断后可从已写入的位置继续，全部写完后再重命名。
+const (
+	WebPort         = 60004
+	webChunkLimit   = 64 * 1024 * 1024 // 单个上传块的最大字节数
+	webReadTimeout  = 5 * time.Minute
+	webTokenBytes   = 16
+	webTokenParam   = "t"
+	webHeaderWrite  = 30 * time.Second
+	webShutdownWait = 5 * time.Second
+)
+
+//go:embed webpage.html
+var webPage []byte
+
+// NewWebToken 生成随机访问令牌
+func NewWebToken() (string, error) {
+	b := make([]byte, webTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成访问令牌失败: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// webFile 为下载页面中的一个文件
+type webFile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	path string
+}
+
+// WebServer 提供浏览器上传页面和下载页面。Dir 为空时不接受上传，Shared 为空时不提供下载。
+type WebServer struct {
+	Dir             string         // 上传文件的保存目录
+	Shared          []string       // 提供下载的文件和文件夹
+	Filter          *Filter        // 下载文件夹时的过滤规则
+	FreeSpaceMargin int64          // 上传后应保留的最小剩余空间（字节）
+	Token           string         // 访问令牌，为空时自动生成
+	Observer        Observer       // 上传进度与状态观察者，可为 nil
+	Limiters        []*RateLimiter // 上传时依次申请令牌的令牌桶
+
+	mu        sync.Mutex
+	srv       *http.Server
+	sess      *session
+	files     []webFile
+	startTime time.Time
+	received  int64
+	completed int
+	uploading map[string]bool // 正在写入的临时文件，同一文件同一时间只接受一个块
+}
+
+// Start 在 addr（如 ":60004"）上启动服务并返回带令牌的访问地址
+func (w *WebServer) Start(addr string) (string, error) {
+	if w.Dir == "" && len(w.Shared) == 0 {
+		return "", fmt.Errorf("未设置保存目录或共享文件")
+	}
+	if w.Token == "" {
+		token, err := NewWebToken()
+		if err != nil {
+			return "", err
+		}
+		w.Token = token
+	}
+
+	files, err := w.collectShared()
+	if err != nil {
+		return "", err
+	}
+	w.files = files
+	w.sess = newSession(w.Observer, w.Limiters)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("监听端口失败: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", w.handlePage)
+	mux.HandleFunc("/api/info", w.handleInfo)
+	mux.HandleFunc("/api/upload/begin", w.handleUploadBegin)
+	mux.HandleFunc("/api/upload/offset", w.handleUploadOffset)
+	mux.HandleFunc("/api/upload", w.handleUpload)
+	mux.HandleFunc("/api/download", w.handleDownload)
+
+	srv := &http.Server{
+		Handler:           w.authorize(mux),
+		ReadHeaderTimeout: webHeaderWrite,
+		ReadTimeout:       webReadTimeout,
+	}
+	w.mu.Lock()
+	w.srv = srv
+	w.mu.Unlock()
+	go srv.Serve(ln)
+
+	host, err := LocalIP()
+	if err != nil {
+		host = "127.0.0.1"
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	link := fmt.Sprintf("http://%s/?%s=%s", net.JoinHostPort(host, strconv.Itoa(port)), webTokenParam, w.Token)
+	w.sess.status("浏览器传输已启动: " + link)
+	return link, nil
+}
+
+// Stop 关闭服务，等待进行中的请求结束
+func (w *WebServer) Stop() error {
+	w.mu.Lock()
+	srv := w.srv
+	w.srv = nil
+	w.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webShutdownWait)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// collectShared 展开共享的文件夹，得到可下载的文件列表
+func (w *WebServer) collectShared() ([]webFile, error) {
+	if len(w.Shared) == 0 {
+		return nil, nil
+	}
+	roots, err := buildSendRoots(w.Shared)
+	if err != nil {
+		return nil, err
+	}
+	var files []webFile
+	for _, root := range roots {
+		err := w.Filter.walk(root.Path, root.Name, func(fullPath, rel string, info os.FileInfo) error {
+			if info.IsDir() || isSymlink(info) {
+				return nil
+			}
+			files = append(files, webFile{ID: len(files), Name: rel, Size: info.Size(), path: fullPath})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// --------------------------- 请求处理 ---------------------------
+// authorize 校验访问令牌，令牌可放在查询参数 t 或请求头 X-Token 中
+func (w *WebServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(webTokenParam)
+		if token == "" {
+			token = r.Header.Get("X-Token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(w.Token)) != 1 {
+			http.Error(rw, "访问令牌无效", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+func (w *WebServer) handlePage(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Write(webPage)
+}
+
+func (w *WebServer) handleInfo(rw http.ResponseWriter, r *http.Request) {
+	files := w.files
+	if files == nil {
+		files = []webFile{}
+	}
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"upload":     w.Dir != "",
+		"files":      files,
+		"chunkLimit": webChunkLimit,
+	})
+}
+
+// handleUploadBegin 接收一批上传的文件数和总大小，检查磁盘空间并开始统计进度
+func (w *WebServer) handleUploadBegin(rw http.ResponseWriter, r *http.Request) {
+	if w.Dir == "" || r.Method != http.MethodPost {
+		http.Error(rw, "不支持上传", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Files int   `json:"files"`
+		Bytes int64 `json:"bytes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil || req.Files < 0 || req.Bytes < 0 {
+		http.Error(rw, "请求格式错误", http.StatusBadRequest)
+		return
+	}
+
+	reject, warning := checkDiskSpace(w.Dir, req.Bytes, w.FreeSpaceMargin)
+	if reject != "" {
+		w.sess.status("已拒绝浏览器上传: " + reject)
+		http.Error(rw, reject, http.StatusInsufficientStorage)
+		return
+	}
+	if warning != "" {
+		w.sess.status("警告: " + warning)
+	}
+
+	w.mu.Lock()
+	w.startTime = time.Now()
+	w.received, w.completed = 0, 0
+	w.mu.Unlock()
+
+	w.sess.status(fmt.Sprintf("浏览器开始上传 %d 个文件", req.Files))
+	w.sess.update(func(st *Stats) {
+		*st = Stats{TotalFiles: req.Files, TotalBytes: req.Bytes, Progress: 0.1, Status: "transferring"}
+	})
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// uploadTarget 解析上传请求中的相对路径，返回最终路径和临时文件路径
+func (w *WebServer) uploadTarget(r *http.Request) (string, string, error) {
+	target, err := confinedJoin(w.Dir, r.URL.Query().Get("path"))
+	if err != nil {
+		return "", "", err
+	}
+	return target, partialPathFor(target), nil
+}
+
+// handleUploadOffset 返回某个文件已上传的字节数，供浏览器断点续传
+func (w *WebServer) handleUploadOffset(rw http.ResponseWriter, r *http.Request) {
+	if w.Dir == "" {
+		http.Error(rw, "不支持上传", http.StatusMethodNotAllowed)
+		return
+	}
+	_, partial, err := w.uploadTarget(r)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var offset int64
+	if fi, err := os.Stat(partial); err == nil {
+		offset = fi.Size()
+	}
+	writeJSON(rw, http.StatusOK, map[string]int64{"offset": offset})
+}
+
+// handleUpload 将请求体写入临时文件的 offset 处，写满 size 后校验并重命名
+func (w *WebServer) handleUpload(rw http.ResponseWriter, r *http.Request) {
+	if w.Dir == "" || (r.Method != http.MethodPut && r.Method != http.MethodPost) {
+		http.Error(rw, "不支持上传", http.StatusMethodNotAllowed)
+		return
+	}
+	target, partial, err := w.uploadTarget(r)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	offset, err1 := strconv.ParseInt(q.Get("offset"), 10, 64)
+	size, err2 := strconv.ParseInt(q.Get("size"), 10, 64)
+	if err1 != nil || err2 != nil || offset < 0 || size < 0 || offset > size {
+		http.Error(rw, "请求格式错误", http.StatusBadRequest)
+		return
+	}
+
+	// 同一文件同一时间只写一个块，避免并发请求交错写入同一临时文件；
+	// 只在登记时持锁，不同文件的上传可以并行，读取请求体时也不阻塞其他请求。
+	// 被占用时返回 423，浏览器稍后按服务器记录的位置重试
+	w.mu.Lock()
+	if w.uploading[partial] {
+		w.mu.Unlock()
+		http.Error(rw, "该文件正在上传", http.StatusLocked)
+		return
+	}
+	if w.uploading == nil {
+		w.uploading = make(map[string]bool)
+	}
+	w.uploading[partial] = true
+	// 未调用 begin 直接上传时，从第一个块开始计时
+	if w.startTime.IsZero() {
+		w.startTime = time.Now()
+	}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.uploading, partial)
+		w.mu.Unlock()
+	}()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		http.Error(rw, fmt.Sprintf("创建目录失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Size() != offset {
+		// 位置不一致时告知浏览器实际位置，由其从该处重新上传
+		f.Close()
+		var current int64
+		if fi != nil {
+			current = fi.Size()
+		}
+		writeJSON(rw, http.StatusConflict, map[string]int64{"offset": current})
+		return
+	}
+
+	limit := size - offset
+	if limit > webChunkLimit {
+		limit = webChunkLimit
+	}
+	f.Seek(offset, io.SeekStart)
+	body := &progressReader{r: io.LimitReader(r.Body, limit), onRead: func(n int64) {
+		w.mu.Lock()
+		w.received += n
+		received, started := w.received, w.startTime
+		w.mu.Unlock()
+		w.sess.progress(filepath.Base(target), received, started)
+	}}
+	written, err := io.Copy(f, w.sess.throttledReader(body))
+	offset += written
+	if err != nil {
+		f.Close()
+		http.Error(rw, fmt.Sprintf("写入文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if offset < size {
+		f.Close()
+		writeJSON(rw, http.StatusOK, map[string]int64{"offset": offset})
+		return
+	}
+
+	if err := commitPartial(f, partial, target, size); err != nil {
+		os.Remove(partial)
+		w.sess.status(err.Error())
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.mu.Lock()
+	w.completed++
+	completed, received := w.completed, w.received
+	w.mu.Unlock()
+	w.sess.update(func(st *Stats) {
+		st.CompletedFiles = completed
+		st.TransferredBytes = received
+		if completed > st.TotalFiles {
+			st.TotalFiles = completed
+		}
+		if received > st.TotalBytes {
+			st.TotalBytes = received
+		}
+		if completed == st.TotalFiles {
+			// 续传前已写入的部分不计入 received，完成时按总大小显示
+			st.Status = "completed"
+			st.Progress = 100
+			st.TransferredBytes = st.TotalBytes
+		}
+	})
+	if completed == w.sess.snapshot().TotalFiles {
+		w.sess.status("浏览器上传完成")
+	}
+	writeJSON(rw, http.StatusOK, map[string]int64{"offset": offset})
+}
+
+// handleDownload 提供共享文件的下载，支持 Range 请求以便断点续传
+func (w *WebServer) handleDownload(rw http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 0 || id >= len(w.files) {
+		http.NotFound(rw, r)
+		return
+	}
+	file := w.files[id]
+	f, err := os.Open(file.path)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("获取文件信息失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.sess.status("浏览器正在下载: " + file.Name)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(path.Base(file.Name))))
+	http.ServeContent(rw, r, path.Base(file.Name), fi.ModTime(), f)
+}
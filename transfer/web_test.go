@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 一个上传块读取请求体时，其他文件的块不应等待，同一文件的块应被拒绝
+func TestWebUploadConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	w := &WebServer{Dir: dir, sess: newSession(nil, nil)}
+	upload := func(path string, body io.Reader, size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/upload?path="+path+"&offset=0&size="+strconv.Itoa(size), body)
+		rec := httptest.NewRecorder()
+		w.handleUpload(rec, req)
+		return rec
+	}
+
+	// 第一个请求的请求体迟迟不到
+	pr, pw := io.Pipe()
+	slow := make(chan *httptest.ResponseRecorder, 1)
+	go func() { slow <- upload("slow.bin", pr, 4) }()
+	pw.Write([]byte("ab"))
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- upload("fast.txt", strings.NewReader("hi"), 2) }()
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK {
+			t.Errorf("其他文件: %d %s", rec.Code, rec.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("其他文件的上传被阻塞")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "fast.txt")); string(data) != "hi" {
+		t.Errorf("fast.txt = %q", data)
+	}
+
+	if rec := upload("slow.bin", strings.NewReader("ab"), 4); rec.Code != http.StatusLocked {
+		t.Errorf("同一文件并发上传: %d，应为 423", rec.Code)
+	}
+
+	pw.Write([]byte("cd"))
+	pw.Close()
+	if rec := <-slow; rec.Code != http.StatusOK {
+		t.Errorf("慢速上传: %d %s", rec.Code, rec.Body)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "slow.bin")); string(data) != "abcd" {
+		t.Errorf("slow.bin = %q", data)
+	}
+}
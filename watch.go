@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"file-transfer-app/transfer"
+)
+
+// --------------------------- 监视目录 ---------------------------
+// watchQueueFile 返回监视目录发送队列的保存位置，无法获取配置目录时不持久化
+func watchQueueFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lanfile", "watch-queue.json")
+}
+
+// watchObserver 将监视状态转发为前端事件
+type watchObserver struct {
+	app *App
+}
+
+func (o watchObserver) WatchStatusChanged(status transfer.WatchStatus) {
+	o.app.emit("watch-status", status)
+}
+
+// --------------------------- 前端绑定方法 ---------------------------
+// StartWatch 监视 dir，新增或修改的文件停止变化后自动发送到 target（为空时自动发现）。
+// 同一时间只监视一个目录，已在监视时先停止原有监视。
+func (a *App) StartWatch(dir, target string, opts transfer.SendOptions) error {
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("监视目录不存在: %v", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("监视的路径不是文件夹: %s", dir)
+	}
+	if _, err := transfer.NewFilter(opts); err != nil {
+		return err
+	}
+	a.StopWatch()
+
+	watcher := &transfer.Watcher{
+		Dir:       dir,
+		Target:    target,
+		Options:   opts,
+		QueueFile: watchQueueFile(),
+		Observer:  watchObserver{a},
+		Limiters:  []*transfer.RateLimiter{a.globalLimiter},
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	a.mu.Lock()
+	a.watcher, a.watchQuit, a.watchDone = watcher, quit, done
+	a.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		if err := watcher.Run(quit); err != nil {
+			status := watcher.Status()
+			status.Watching = false
+			status.LastError = err.Error()
+			status.Message = err.Error()
+			a.emit("watch-status", status)
+		}
+	}()
+	return nil
+}
+
+// StopWatch 停止监视，进行中的发送会被取消，未发送的文件在下次监视同一目录时继续发送
+func (a *App) StopWatch() {
+	a.mu.Lock()
+	quit, done := a.watchQuit, a.watchDone
+	a.watcher, a.watchQuit, a.watchDone = nil, nil, nil
+	a.mu.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+// GetWatchStatus 返回监视目录的当前状态，未在监视时 watching 为 false
+func (a *App) GetWatchStatus() transfer.WatchStatus {
+	a.mu.Lock()
+	watcher := a.watcher
+	a.mu.Unlock()
+	if watcher == nil {
+		return transfer.WatchStatus{}
+	}
+	return watcher.Status()
+}